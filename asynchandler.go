@@ -0,0 +1,100 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultAsyncQueueSize is the number of records queued by AsyncHandler when created with a non positive size.
+const DefaultAsyncQueueSize = 1000
+
+// AsyncHandler decorates a handler emitting the records from a goroutine, so logging calls don't
+// wait for slow outputs. Records are dropped when the queue is full, and counted by Dropped.
+type AsyncHandler struct {
+	Handler
+	dropped uint64
+
+	m       sync.RWMutex
+	queue   chan asyncEntry
+	stopped chan struct{}
+	closed  bool
+}
+
+// asyncEntry is a record to emit, or a request to signal flushed once the previous records are emitted.
+type asyncEntry struct {
+	rec     *Record
+	flushed chan struct{}
+}
+
+// NewAsyncHandler returns an AsyncHandler queueing up to size records, DefaultAsyncQueueSize if size is not positive.
+func NewAsyncHandler(handler Handler, size int) *AsyncHandler {
+	if size <= 0 {
+		size = DefaultAsyncQueueSize
+	}
+	h := &AsyncHandler{
+		Handler: handler,
+		queue:   make(chan asyncEntry, size),
+		stopped: make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *AsyncHandler) run() {
+	defer close(h.stopped)
+	for entry := range h.queue {
+		if entry.flushed != nil {
+			close(entry.flushed)
+			continue
+		}
+		h.Handler.Handle(entry.rec)
+	}
+}
+
+func (h *AsyncHandler) Handle(rec *Record) {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.queue <- asyncEntry{rec: rec}:
+	default:
+		atomic.AddUint64(&h.dropped, 1)
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (h *AsyncHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Flush waits until the queued records are emitted, and flushes the decorated handler if it implements Flusher.
+func (h *AsyncHandler) Flush() error {
+	h.m.RLock()
+	if !h.closed {
+		flushed := make(chan struct{})
+		h.queue <- asyncEntry{flushed: flushed}
+		h.m.RUnlock()
+		<-flushed
+	} else {
+		h.m.RUnlock()
+	}
+
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// Close emits the queued records and closes the decorated handler, records handled afterwards are discarded.
+func (h *AsyncHandler) Close() error {
+	h.m.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.m.Unlock()
+	<-h.stopped
+	return h.Handler.Close()
+}
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncHandler(t *testing.T) {
+	var m sync.Mutex
+	var messages []string
+	h := NewAsyncHandler(handlerFunc(func(rec *Record) {
+		m.Lock()
+		defer m.Unlock()
+		messages = append(messages, rec.Message)
+	}), 0)
+
+	h.Handle(&Record{Message: "first"})
+	h.Handle(&Record{Message: "second"})
+	require.NoError(t, h.Flush())
+	m.Lock()
+	assert.Equal(t, []string{"first", "second"}, messages)
+	m.Unlock()
+
+	h.Handle(&Record{Message: "third"})
+	require.NoError(t, h.Close())
+	h.Handle(&Record{Message: "after close"})
+	require.NoError(t, h.Flush())
+	assert.Equal(t, []string{"first", "second", "third"}, messages)
+}
+
+func TestAsyncHandlerDropsRecordsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	var messages []string
+	h := NewAsyncHandler(handlerFunc(func(rec *Record) {
+		<-release
+		messages = append(messages, rec.Message)
+	}), 1)
+
+	h.Handle(&Record{Message: "blocking"})
+	for i := 0; i < 5; i++ {
+		h.Handle(&Record{Message: "queued or dropped"})
+	}
+	assert.True(t, h.Dropped() >= 3)
+
+	close(release)
+	require.NoError(t, h.Close())
+	assert.Equal(t, uint64(len(messages)), 6-h.Dropped())
+}
@@ -3,6 +3,9 @@ package log
 type BaseHandler struct {
 	Level     Level
 	Formatter Formatter
+	// FilterReleased makes Filter apply the level to records released by request buffers too,
+	// for handlers whose records alert someone.
+	FilterReleased bool
 }
 
 func NewBaseHandler() *BaseHandler {
@@ -20,8 +23,14 @@ func (h *BaseHandler) SetFormatter(f Formatter) {
 	h.Formatter = f
 }
 
+// Filter returns whether the record passes the level of the handler.
+// Records released by request buffers pass regardless of the level, unless FilterReleased is set.
+func (h *BaseHandler) Filter(rec *Record) bool {
+	return rec.Level <= h.Level || rec.Released && !h.FilterReleased
+}
+
 func (h *BaseHandler) FilterAndFormat(rec *Record) string {
-	if rec.Level > h.Level {
+	if !h.Filter(rec) {
 		return ""
 	}
 	return h.Formatter.Format(rec)
@@ -0,0 +1,114 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// batcher groups records in batches sent from a single goroutine, when a batch reaches its
+// maximum size, when the flush interval elapses, when it's flushed and when it's closed.
+type batcher struct {
+	size     int
+	interval time.Duration
+	send     func([]*Record)
+
+	records   chan *Record
+	flushes   chan chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// newBatcher starts a batcher calling send with batches of at most size records,
+// at least every interval while there are pending records.
+func newBatcher(size int, interval time.Duration, send func([]*Record)) *batcher {
+	b := &batcher{
+		size:     size,
+		interval: interval,
+		send:     send,
+		records:  make(chan *Record, size),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues the record, blocking while the queue is full. Records added after closing are dropped.
+// Records are queued without their context, so it isn't kept alive until the batch is sent.
+func (b *batcher) add(rec *Record) {
+	if rec.Context != nil {
+		copied := *rec
+		copied.Context = nil
+		rec = &copied
+	}
+	select {
+	case b.records <- rec:
+	case <-b.stopped:
+	}
+}
+
+// flush sends the queued records and waits for them to be sent.
+func (b *batcher) flush() {
+	sent := make(chan struct{})
+	select {
+	case b.flushes <- sent:
+		<-sent
+	case <-b.stopped:
+	}
+}
+
+// close sends the queued records and stops the batcher.
+func (b *batcher) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+	<-b.stopped
+}
+
+func (b *batcher) run() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]*Record, 0, b.size)
+	sendBatch := func() {
+		if len(batch) > 0 {
+			b.send(batch)
+			batch = make([]*Record, 0, b.size)
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case rec := <-b.records:
+				batch = append(batch, rec)
+				if len(batch) >= b.size {
+					sendBatch()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case rec := <-b.records:
+			batch = append(batch, rec)
+			if len(batch) >= b.size {
+				sendBatch()
+			}
+		case <-ticker.C:
+			sendBatch()
+		case sent := <-b.flushes:
+			drain()
+			sendBatch()
+			close(sent)
+		case <-b.done:
+			drain()
+			sendBatch()
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"path"
+	"runtime"
+	"strings"
+	"testing"
+
+	log "github.com/cabify/go-logging"
+	"github.com/cabify/go-logging/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallerIsTheUserCallSite(t *testing.T) {
+	recorder := logtest.InstallRecorder(t)
+	previousExit, previousHandler := log.ExitFunc, log.DefaultHandler
+	log.ExitFunc, log.DefaultHandler = func(int) {}, recorder
+	defer func() { log.ExitFunc, log.DefaultHandler = previousExit, previousHandler }()
+
+	logger := log.NewLogger("test")
+	logger.SetHandler(recorder)
+	ctx := log.WithBaggageValue(context.Background(), "key", "value")
+
+	for name, logAndReturnLine := range map[string]func() int{
+		"logger method": func() int {
+			line := nextLine()
+			logger.Info("message")
+			return line
+		},
+		"logger formatting method": func() int {
+			line := nextLine()
+			logger.Errorf("message %d", 1)
+			return line
+		},
+		"logger ln method": func() int {
+			line := nextLine()
+			logger.Warningln("message")
+			return line
+		},
+		"package function": func() int {
+			line := nextLine()
+			log.Notice("message")
+			return line
+		},
+		"package fatal function": func() int {
+			line := nextLine()
+			log.Fatalf("message %d", 1)
+			return line
+		},
+		"package panic function": func() (line int) {
+			defer func() { _ = recover() }()
+			line = nextLine()
+			log.Panicln("message")
+			return line
+		},
+		"context logger": func() int {
+			line := nextLine()
+			log.For(ctx).Criticalf("message %d", 1)
+			return line
+		},
+		"no debug logger": func() int {
+			line := nextLine()
+			log.NoDebugLogger{Logger: logger}.Info("message")
+			return line
+		},
+		"logger with error": func() int {
+			line := nextLine()
+			log.For(ctx).(log.ErrorLogger).WithError(errors.New("boom")).Error("message")
+			return line
+		},
+		"helper": func() int {
+			line := nextLine()
+			logHelper(logger, "message")
+			return line
+		},
+		"nested helpers": func() int {
+			line := nextLine()
+			nestedLogHelper(logger, "message")
+			return line
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			recorder.Reset()
+			line := logAndReturnLine()
+
+			records := recorder.Records()
+			require.Len(t, records, 1)
+			assertCaller(t, records[0], line)
+		})
+	}
+}
+
+func TestCallDepthSkipsWrappers(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	logger := log.NewLogger("test")
+	logger.SetHandler(recorder)
+	logger.SetCallDepth(1)
+
+	line := nextLine()
+	logWrapper(logger, "message")
+
+	records := recorder.Records()
+	require.Len(t, records, 1)
+	assertCaller(t, records[0], line)
+}
+
+func TestRecoveredPanicsReportThePanicSite(t *testing.T) {
+	recorder := logtest.InstallRecorder(t)
+
+	var line int
+	func() {
+		defer log.RecoverAndLog(context.Background())
+		line = nextLine()
+		panic("boom")
+	}()
+
+	records := recorder.Records()
+	require.Len(t, records, 1)
+	assertCaller(t, records[0], line)
+}
+
+func assertCaller(t *testing.T, rec log.Record, line int) {
+	_, file, _, _ := runtime.Caller(0)
+	assert.Equal(t, file, rec.Filename)
+	assert.Equal(t, path.Join(path.Base(path.Dir(file)), "caller_test.go"), rec.ShortFilename)
+	assert.Equal(t, line, rec.Line)
+	assert.Equal(t, "github.com/cabify/go-logging_test", rec.Package)
+	assert.True(t, strings.HasPrefix(rec.Function, "github.com/cabify/go-logging_test.Test"), rec.Function)
+}
+
+func logHelper(logger log.Logger, message string) {
+	log.Helper()
+	logger.Info(message)
+}
+
+func nestedLogHelper(logger log.Logger, message string) {
+	log.Helper()
+	logHelper(logger, message)
+}
+
+func logWrapper(logger log.Logger, message string) {
+	logger.Info(message)
+}
+
+// nextLine returns the line following the call to nextLine.
+func nextLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line + 1
+}
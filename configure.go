@@ -6,13 +6,43 @@ import (
 
 // Config defines the logging configuration
 type Config struct {
-	Level  string `default:"info"`
+	Level string `default:"info"`
+	// Levels, if set, overrides Level with a spec of levels by logger name prefix like
+	// "info,payments=debug", see ParseLevelSpec. The LOG_LEVELS environment variable overrides it.
+	Levels string `default:""`
 	Output string `default:"stdout"`
+	// ErrorOutput, if set, receives the ERROR and CRITICAL records instead of Output,
+	// like "stderr" to split them from the rest in "stdout".
+	ErrorOutput string `default:""`
+	// Filter, if set, is an expression of the records to log, see ParsePredicate.
+	Filter string `default:""`
+	// TimeLayout is the time layout of the formatter: "default", "rfc3339", "rfc3339nano",
+	// "epochmillis" or any layout accepted by time.Format.
+	TimeLayout string `default:"default"`
+	// UTC formats times in UTC instead of local time.
+	UTC bool `default:"false"`
 }
 
+// configuredHandler is the handler registered by the last call to ConfigureDefaultLogger,
+// replaced in the registry by the next one.
+var configuredHandler Handler
+
 // ConfigureDefaultLogger configures loggers for your service, optionally adding log message counters with your favorite
-// metrics system
+// metrics system. DefaultLogger is replaced, also as the base logger of DefaultFactory, like in ConfigureFromFileConfig.
 func ConfigureDefaultLogger(name string, cfg Config, logCounters ...CountLogMessage) {
+	if levels := os.Getenv(LevelsEnvVar); levels != "" {
+		cfg.Levels = levels
+	}
+	var spec *LevelSpec
+	if cfg.Levels != "" {
+		if s, err := ParseLevelSpec(cfg.Levels); err == nil {
+			spec = &s
+			cfg.Level = logLevelNameMap[s.Default]
+		} else {
+			Warningf("Unknown log levels configured: %v", err)
+		}
+	}
+
 	if logLevel, ok := logLevelMap[cfg.Level]; ok {
 		SetLevel(logLevel) // This sets the default level for all future
 		DefaultLevel = logLevel
@@ -20,7 +50,14 @@ func ConfigureDefaultLogger(name string, cfg Config, logCounters ...CountLogMess
 		Warningf("Unknown log level configured: %s", cfg.Level)
 	}
 
-	var handler Handler = NewFileHandler(getLoggerOutput(cfg.Output))
+	handler := outputHandler(cfg)
+	if cfg.Filter != "" {
+		if predicate, err := ParsePredicate(cfg.Filter); err == nil {
+			handler = NewFilterHandler(handler, predicate)
+		} else {
+			Warningf("Unknown log filter configured: %v", err)
+		}
+	}
 
 	if len(logCounters) > 0 {
 		handler = &metricsAgentLoggingHandler{
@@ -28,20 +65,60 @@ func ConfigureDefaultLogger(name string, cfg Config, logCounters ...CountLogMess
 			logCounters: logCounters,
 		}
 	}
-	handler.SetFormatter(DefaultFormatter)
+	formatter := DefaultFormatter
+	if (cfg.TimeLayout != "" && cfg.TimeLayout != "default") || cfg.UTC {
+		formatter = NewDefaultFormatter(getTimeLayout(cfg.TimeLayout), cfg.UTC)
+	}
+	handler.SetFormatter(formatter)
+	replaceRegisteredHandler(configuredHandler, handler)
+	configuredHandler = handler
+
+	debug := cfg.Level == logLevelDebug
+	if spec != nil {
+		// The handler emits the records of the overrides, loggers filter them by their level.
+		handler.SetLevel(spec.verbosest())
+		debug = spec.Level(name) == DEBUG
+	}
 
 	logger := NewLogger(name)
-	if cfg.Level != logLevelDebug {
+	if !debug {
 		logger = NoDebugLogger{
 			Logger: logger,
 		}
 	}
 	logger.SetHandler(handler)
 
-	DefaultLogger = logger
+	setDefaultLogger(logger)
+	if spec != nil {
+		SetLevelSpec(*spec)
+		Infof("Configured default logger %s with log levels %s", name, spec)
+		return
+	}
 	Infof("Configured default logger %s with log level %s", name, cfg.Level)
 }
 
+// setDefaultLogger replaces DefaultLogger, and the base logger of DefaultFactory unless it was
+// replaced with another LoggerFactory, so the loggers obtained afterwards with For use it.
+func setDefaultLogger(logger Logger) {
+	DefaultLogger = logger
+	if _, ok := DefaultFactory.(Factory); ok {
+		DefaultFactory = NewFactory()
+	}
+}
+
+// outputHandler returns the handler writing to the outputs of the config.
+func outputHandler(cfg Config) Handler {
+	if cfg.ErrorOutput == "" {
+		return NewFileHandler(getLoggerOutput(cfg.Output))
+	}
+	return &LevelRoutingHandler{
+		routes: []LevelRoute{
+			{LeastSevere: ERROR, MostSevere: CRITICAL, Handler: NewFileHandler(getLoggerOutput(cfg.ErrorOutput))},
+		},
+		defaultHandler: NewFileHandler(getLoggerOutput(cfg.Output)),
+	}
+}
+
 func getLoggerOutput(outputName string) *os.File {
 	switch outputName {
 	case "stdout":
@@ -53,3 +130,13 @@ func getLoggerOutput(outputName string) *os.File {
 		return os.Stderr
 	}
 }
+
+func getTimeLayout(layoutName string) string {
+	if layout, ok := timeLayoutNames[layoutName]; ok {
+		return layout
+	}
+	if layoutName == "" {
+		return DefaultTimeLayout
+	}
+	return layoutName
+}
@@ -7,9 +7,53 @@ import (
 	"strings"
 )
 
+// baggageLogger is the Logger returned by For. It shares the base logger of the factory,
+// so later changes to it apply, and attaches the context and its request buffer to the records.
 type baggageLogger struct {
 	Logger
-	ctx context.Context
+	ctx    context.Context
+	buffer *requestBuffer
+}
+
+// contextEmitter is implemented by the loggers of this package, which emit the records of
+// the loggers returned by For with the baggage of their context and in its request buffer.
+type contextEmitter interface {
+	enabled(level Level, buffer *requestBuffer) bool
+	emit(ctx context.Context, buffer *requestBuffer, level Level, message string)
+	fatal(ctx context.Context, buffer *requestBuffer, message string)
+}
+
+// emit logs the message with l, attaching ctx and holding the record in buffer if l implements
+// contextEmitter, or calling the method of the level otherwise.
+func emit(l Logger, ctx context.Context, buffer *requestBuffer, level Level, message string) {
+	if e, ok := l.(contextEmitter); ok {
+		e.emit(ctx, buffer, level, message)
+		return
+	}
+	switch level {
+	case CRITICAL:
+		l.Critical(message)
+	case ERROR:
+		l.Error(message)
+	case WARNING:
+		l.Warning(message)
+	case NOTICE:
+		l.Notice(message)
+	case INFO:
+		l.Info(message)
+	default:
+		l.Debug(message)
+	}
+}
+
+// fatal logs the message with the Fatal path of l, attaching ctx and using buffer if l
+// implements contextEmitter, or calling its Fatal method otherwise.
+func fatal(l Logger, ctx context.Context, buffer *requestBuffer, message string) {
+	if e, ok := l.(contextEmitter); ok {
+		e.fatal(ctx, buffer, message)
+		return
+	}
+	l.Fatal(message)
 }
 
 func baggageString(b map[string]interface{}) string {
@@ -36,6 +80,7 @@ func NewFactory() Factory {
 }
 
 // For provides a logger which is aware of the passed context and will prepend the context baggage values.
+// The baggage is also available to handlers as Record.Baggage.
 func (f Factory) For(ctx context.Context) Logger {
 	return newBaggageLogger(ctx, f.baseLogger)
 }
@@ -44,9 +89,14 @@ func newBaggageLogger(ctx context.Context, base Logger) baggageLogger {
 	return baggageLogger{
 		Logger: base,
 		ctx:    ctx,
+		buffer: requestBufferFrom(ctx),
 	}
 }
 
+func (l baggageLogger) WithError(err error) Logger {
+	return newBaggageLogger(l.ctx, withError(l.Logger, err))
+}
+
 func (l baggageLogger) getContextString() string {
 	baggage, ok := l.ctx.Value(BaggageContextKey).(map[string]interface{})
 	if !ok {
@@ -56,98 +106,128 @@ func (l baggageLogger) getContextString() string {
 	return baggageString(baggage) + ": "
 }
 
+func (l baggageLogger) log(level Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.emit(level, fmt.Sprint(append([]interface{}{l.getContextString()}, args...)...))
+	}
+}
+
+func (l baggageLogger) logf(level Level, format string, args ...interface{}) {
+	if l.enabled(level) {
+		l.emit(level, fmt.Sprintf(l.getContextString()+format, args...))
+	}
+}
+
+func (l baggageLogger) logln(level Level, args ...interface{}) {
+	if l.enabled(level) {
+		l.emit(level, fmt.Sprintln(append([]interface{}{l.getContextString()}, args...)...))
+	}
+}
+
+func (l baggageLogger) enabled(level Level) bool {
+	e, ok := l.Logger.(contextEmitter)
+	return !ok || e.enabled(level, l.buffer)
+}
+
+func (l baggageLogger) emit(level Level, message string) {
+	emit(l.Logger, l.ctx, l.buffer, level, message)
+}
+
 func (l baggageLogger) Fatal(args ...interface{}) {
-	l.Logger.Fatal(append([]interface{}{l.getContextString()}, args...)...)
+	fatal(l.Logger, l.ctx, l.buffer, fmt.Sprint(append([]interface{}{l.getContextString()}, args...)...))
 }
 
 func (l baggageLogger) Fatalf(format string, args ...interface{}) {
-	l.Logger.Fatalf(l.getContextString()+format, args...)
+	fatal(l.Logger, l.ctx, l.buffer, fmt.Sprintf(l.getContextString()+format, args...))
 }
 
 func (l baggageLogger) Fatalln(args ...interface{}) {
-	l.Logger.Fatalln(append([]interface{}{l.getContextString()}, args...)...)
+	fatal(l.Logger, l.ctx, l.buffer, fmt.Sprintln(append([]interface{}{l.getContextString()}, args...)...))
 }
 
 func (l baggageLogger) Panic(args ...interface{}) {
-	l.Logger.Panic(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(CRITICAL, args...)
+	panic(fmt.Sprint(append([]interface{}{l.getContextString()}, args...)...))
 }
 
 func (l baggageLogger) Panicf(format string, args ...interface{}) {
-	l.Logger.Panicf(l.getContextString()+format, args...)
+	l.logf(CRITICAL, format, args...)
+	panic(fmt.Sprintf(l.getContextString()+format, args...))
 }
 
 func (l baggageLogger) Panicln(args ...interface{}) {
-	l.Logger.Panicln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(CRITICAL, args...)
+	panic(fmt.Sprintln(append([]interface{}{l.getContextString()}, args...)...))
 }
 
 func (l baggageLogger) Critical(args ...interface{}) {
-	l.Logger.Critical(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(CRITICAL, args...)
 }
 
 func (l baggageLogger) Criticalf(format string, args ...interface{}) {
-	l.Logger.Criticalf(l.getContextString()+format, args...)
+	l.logf(CRITICAL, format, args...)
 }
 
 func (l baggageLogger) Criticalln(args ...interface{}) {
-	l.Logger.Criticalln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(CRITICAL, args...)
 }
 
 func (l baggageLogger) Error(args ...interface{}) {
-	l.Logger.Error(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(ERROR, args...)
 }
 
 func (l baggageLogger) Errorf(format string, args ...interface{}) {
-	l.Logger.Errorf(l.getContextString()+format, args...)
+	l.logf(ERROR, format, args...)
 }
 
 func (l baggageLogger) Errorln(args ...interface{}) {
-	l.Logger.Errorln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(ERROR, args...)
 }
 
 func (l baggageLogger) Warning(args ...interface{}) {
-	l.Logger.Warning(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(WARNING, args...)
 }
 
 func (l baggageLogger) Warningf(format string, args ...interface{}) {
-	l.Logger.Warningf(l.getContextString()+format, args...)
+	l.logf(WARNING, format, args...)
 }
 
 func (l baggageLogger) Warningln(args ...interface{}) {
-	l.Logger.Warningln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(WARNING, args...)
 }
 
 func (l baggageLogger) Notice(args ...interface{}) {
-	l.Logger.Notice(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(NOTICE, args...)
 }
 
 func (l baggageLogger) Noticef(format string, args ...interface{}) {
-	l.Logger.Noticef(l.getContextString()+format, args...)
+	l.logf(NOTICE, format, args...)
 }
 
 func (l baggageLogger) Noticeln(args ...interface{}) {
-	l.Logger.Noticeln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(NOTICE, args...)
 }
 
 func (l baggageLogger) Info(args ...interface{}) {
-	l.Logger.Info(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(INFO, args...)
 }
 
 func (l baggageLogger) Infof(format string, args ...interface{}) {
-	l.Logger.Infof(l.getContextString()+format, args...)
+	l.logf(INFO, format, args...)
 }
 
 func (l baggageLogger) Infoln(args ...interface{}) {
-	l.Logger.Infoln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(INFO, args...)
 }
 
 func (l baggageLogger) Debug(args ...interface{}) {
-	l.Logger.Debug(append([]interface{}{l.getContextString()}, args...)...)
+	l.log(DEBUG, args...)
 }
 
 func (l baggageLogger) Debugf(format string, args ...interface{}) {
-	l.Logger.Debugf(l.getContextString()+format, args...)
+	l.logf(DEBUG, format, args...)
 }
 
 func (l baggageLogger) Debugln(args ...interface{}) {
-	l.Logger.Debugln(append([]interface{}{l.getContextString()}, args...)...)
+	l.logln(DEBUG, args...)
 }
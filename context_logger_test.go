@@ -0,0 +1,99 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForFollowsChangesOfTheBaseLogger(t *testing.T) {
+	l := NewLogger("test")
+	log := Factory{baseLogger: l}.For(WithBaggageValue(context.Background(), "key", "value"))
+
+	var records []*Record
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	l.SetLevel(DEBUG)
+	log.Debug("logged")
+
+	require.Len(t, records, 1)
+	assert.Equal(t, "key:value: logged", records[0].Message)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, records[0].Baggage)
+}
+
+func TestForAllocatesOnlyTheLogger(t *testing.T) {
+	factory := Factory{baseLogger: NewLogger("test")}
+	ctx := WithBaggageValue(context.Background(), "key", "value")
+
+	allocs := testing.AllocsPerRun(100, func() { factory.For(ctx) })
+	assert.True(t, allocs <= 1, "allocations: %v", allocs)
+}
+
+func TestConfigureDefaultLoggerReplacesTheBaseLoggerOfFor(t *testing.T) {
+	defer restoreShutdownState()()
+	defer func(level Level) { DefaultLevel = level }(DefaultLevel)
+	DefaultLogger, DefaultHandler = NewLogger("test"), newCloseRecorder()
+
+	ConfigureDefaultLogger("test", Config{Level: "error", Output: "stdout"})
+	assert.True(t, For(context.Background()).(baggageLogger).Logger == DefaultLogger)
+}
+
+func TestConfigureFromFileConfigReplacesTheBaseLoggerOfFor(t *testing.T) {
+	defer func(level Level, restore func()) {
+		restore()
+		setLevelOverrides(nil)
+		SetLevel(level)
+		DefaultLevel = level
+	}(DefaultLevel, restoreShutdownState())
+
+	require.NoError(t, ConfigureFromFileConfig(FileConfig{
+		Handlers: map[string]HandlerConfig{"console": {Type: "stdout"}},
+		Root:     LoggerConfig{Level: "error", Handler: "console"},
+	}))
+	assert.True(t, For(context.Background()).(baggageLogger).Logger == DefaultLogger)
+}
+
+func TestConfiguringKeepsCustomFactories(t *testing.T) {
+	defer restoreShutdownState()()
+	defer func(level Level) { DefaultLevel = level }(DefaultLevel)
+	DefaultLogger, DefaultHandler = NewLogger("test"), newCloseRecorder()
+	factory := customFactory{}
+	DefaultFactory = factory
+
+	ConfigureDefaultLogger("test", Config{Level: "error", Output: "stdout"})
+	assert.Equal(t, factory, DefaultFactory)
+}
+
+type customFactory struct{}
+
+func (customFactory) For(context.Context) Logger { return DefaultLogger }
+
+func TestForFatalUsesTheFatalPathOfTheBaseLogger(t *testing.T) {
+	defer restoreShutdownState()()
+	var codes []int
+	ExitFunc = func(code int) { codes = append(codes, code) }
+	ctx := WithBaggageValue(context.Background(), "key", "value")
+
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	Factory{baseLogger: NoDebugLogger{Logger: l}}.For(ctx).Fatalf("bye %s", "world")
+	require.Len(t, records, 1)
+	assert.Equal(t, "key:value: bye world", records[0].Message)
+	assert.Equal(t, map[string]interface{}{"key": "value"}, records[0].Baggage)
+	assert.Equal(t, []int{1}, codes)
+
+	base := &fatalRecorder{Logger: l}
+	Factory{baseLogger: base}.For(ctx).Fatal("overridden")
+	assert.Equal(t, []interface{}{"key:value: overridden"}, base.fatal)
+	assert.Equal(t, []int{1}, codes, "the Fatal method of the base logger decides whether to exit")
+}
+
+// fatalRecorder is a Logger implemented outside this package overriding Fatal.
+type fatalRecorder struct {
+	Logger
+	fatal []interface{}
+}
+
+func (l *fatalRecorder) Fatal(args ...interface{}) { l.fatal = append(l.fatal, args...) }
@@ -0,0 +1,280 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of ElasticsearchConfig.
+const (
+	DefaultElasticsearchIndex           = "logs-"
+	DefaultElasticsearchIndexDateLayout = "2006.01.02"
+	DefaultElasticsearchBatchSize       = 500
+	DefaultElasticsearchFlushInterval   = time.Second
+	DefaultElasticsearchMaxRetries      = 3
+	DefaultElasticsearchRetryWait       = 500 * time.Millisecond
+	DefaultElasticsearchTimeout         = 10 * time.Second
+)
+
+// ElasticsearchConfig configures an ElasticsearchHandler.
+type ElasticsearchConfig struct {
+	// URL of the cluster, like "http://localhost:9200".
+	URL string
+	// Index is the prefix of the index names, DefaultElasticsearchIndex by default.
+	Index string
+	// IndexDateLayout is the layout of the date suffix of the index names, formatted
+	// with the UTC time of each record, DefaultElasticsearchIndexDateLayout by default.
+	IndexDateLayout string
+	// Username and Password are sent with basic authentication if Username is not empty.
+	Username string
+	Password string
+	// BatchSize is the maximum number of records of each bulk request, DefaultElasticsearchBatchSize by default.
+	BatchSize int
+	// FlushInterval is the maximum time a record waits to be sent, DefaultElasticsearchFlushInterval by default.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times failed documents are sent again, DefaultElasticsearchMaxRetries
+	// by default, negative to never retry.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled on each retry, DefaultElasticsearchRetryWait by default.
+	RetryWait time.Duration
+	// Client sends the requests, a client with a DefaultElasticsearchTimeout timeout by default.
+	Client *http.Client
+}
+
+// ElasticsearchStats are the counters of the documents sent by an ElasticsearchHandler.
+type ElasticsearchStats struct {
+	Indexed uint64 // Documents indexed
+	Failed  uint64 // Documents dropped after failing to be indexed
+	Retried uint64 // Times a document was sent again
+}
+
+// ElasticsearchHandler indexes the logging output in Elasticsearch or OpenSearch with the
+// bulk API. Records are sent in batches as documents with the fields of the record, the
+// baggage keys and an @timestamp field, to daily indices by default. Documents rejected
+// with 429 or 5xx statuses are retried, and documents that can't be indexed are dropped,
+// reporting the error with OnHandlerError. The formatter is not used.
+type ElasticsearchHandler struct {
+	// Counters accessed atomically, first to be 64-bit aligned on 32-bit platforms.
+	indexed uint64
+	failed  uint64
+	retried uint64
+
+	*BaseHandler
+	cfg     ElasticsearchConfig
+	bulkURL string
+	batcher *batcher
+}
+
+// esDocument is a document of a bulk request.
+type esDocument struct {
+	index  string
+	source []byte
+}
+
+// NewElasticsearchHandler returns an ElasticsearchHandler indexing in the configured cluster.
+func NewElasticsearchHandler(cfg ElasticsearchConfig) (*ElasticsearchHandler, error) {
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid Elasticsearch URL: %v", err)
+	}
+	if cfg.Index == "" {
+		cfg.Index = DefaultElasticsearchIndex
+	}
+	if cfg.IndexDateLayout == "" {
+		cfg.IndexDateLayout = DefaultElasticsearchIndexDateLayout
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultElasticsearchBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultElasticsearchFlushInterval
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultElasticsearchMaxRetries
+	}
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = DefaultElasticsearchRetryWait
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultElasticsearchTimeout}
+	}
+
+	h := &ElasticsearchHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		bulkURL:     strings.TrimSuffix(cfg.URL, "/") + "/_bulk",
+	}
+	h.batcher = newBatcher(cfg.BatchSize, cfg.FlushInterval, h.send)
+	return h, nil
+}
+
+func (h *ElasticsearchHandler) Handle(rec *Record) {
+	if !h.BaseHandler.Filter(rec) {
+		return
+	}
+	h.batcher.add(rec)
+}
+
+// Flush sends the pending records.
+func (h *ElasticsearchHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the pending records.
+func (h *ElasticsearchHandler) Close() error {
+	h.batcher.close()
+	return nil
+}
+
+// Stats returns the counters of the documents sent by the handler.
+func (h *ElasticsearchHandler) Stats() ElasticsearchStats {
+	return ElasticsearchStats{
+		Indexed: atomic.LoadUint64(&h.indexed),
+		Failed:  atomic.LoadUint64(&h.failed),
+		Retried: atomic.LoadUint64(&h.retried),
+	}
+}
+
+// send indexes a batch, retrying the failed documents with exponential backoff.
+func (h *ElasticsearchHandler) send(batch []*Record) {
+	docs := make([]esDocument, 0, len(batch))
+	for _, rec := range batch {
+		fields := recordFields(rec)
+		fields["@timestamp"] = rec.Time.Format(time.RFC3339Nano)
+		source, err := json.Marshal(fields)
+		if err != nil {
+			h.fail(1, err)
+			continue
+		}
+		docs = append(docs, esDocument{
+			index:  h.cfg.Index + rec.Time.UTC().Format(h.cfg.IndexDateLayout),
+			source: source,
+		})
+	}
+
+	wait := h.cfg.RetryWait
+	for retry := 0; len(docs) > 0; retry++ {
+		pending, err := h.bulk(docs)
+		if len(pending) == 0 {
+			return
+		}
+		if retry >= h.cfg.MaxRetries {
+			h.fail(len(pending), err)
+			return
+		}
+		atomic.AddUint64(&h.retried, uint64(len(pending)))
+		time.Sleep(wait)
+		wait *= 2
+		docs = pending
+	}
+}
+
+// bulk sends a bulk request with the documents, and returns the ones that can be retried
+// along with the last error. Documents that can't be retried are counted as failed.
+func (h *ElasticsearchHandler) bulk(docs []esDocument) ([]esDocument, error) {
+	body := &bytes.Buffer{}
+	for _, doc := range docs {
+		action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": doc.index}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.source)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.bulkURL, body)
+	if err != nil {
+		h.fail(len(docs), err)
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if h.cfg.Username != "" {
+		req.SetBasicAuth(h.cfg.Username, h.cfg.Password)
+	}
+
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return docs, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(message))
+		if esRetryableStatus(resp.StatusCode) {
+			return docs, err
+		}
+		h.fail(len(docs), err)
+		return nil, err
+	}
+
+	var result struct {
+		Errors bool                            `json:"errors"`
+		Items  []map[string]esBulkItemResponse `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		err = fmt.Errorf("can't decode bulk response: %v", err)
+		h.fail(len(docs), err)
+		return nil, err
+	}
+	if !result.Errors {
+		atomic.AddUint64(&h.indexed, uint64(len(docs)))
+		return nil, nil
+	}
+	if len(result.Items) != len(docs) {
+		err := fmt.Errorf("bulk response has %d items for %d documents", len(result.Items), len(docs))
+		h.fail(len(docs), err)
+		return nil, err
+	}
+
+	var pending []esDocument
+	var failed int
+	var lastErr error
+	for i, item := range result.Items {
+		for _, response := range item {
+			switch {
+			case response.Status/100 == 2:
+				atomic.AddUint64(&h.indexed, 1)
+			case esRetryableStatus(response.Status):
+				pending = append(pending, docs[i])
+				lastErr = response.err()
+			default:
+				failed++
+				lastErr = response.err()
+			}
+		}
+	}
+	if failed > 0 {
+		h.fail(failed, lastErr)
+	}
+	return pending, lastErr
+}
+
+// fail counts the documents as failed and reports the error.
+func (h *ElasticsearchHandler) fail(count int, err error) {
+	atomic.AddUint64(&h.failed, uint64(count))
+	OnHandlerError(fmt.Errorf("can't index %d records in Elasticsearch: %v", count, err))
+}
+
+// esBulkItemResponse is the result of an action of a bulk request.
+type esBulkItemResponse struct {
+	Status int `json:"status"`
+	Error  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+func (r esBulkItemResponse) err() error {
+	return fmt.Errorf("status %d: %s: %s", r.Status, r.Error.Type, r.Error.Reason)
+}
+
+func esRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status/100 == 5
+}
@@ -0,0 +1,202 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type esBulkRequest struct {
+	actions []map[string]map[string]string
+	docs    []map[string]interface{}
+}
+
+func TestElasticsearchHandlerIndexesDocuments(t *testing.T) {
+	var username, password, contentType string
+	requests := serveElasticsearch(t, func(r *http.Request, req esBulkRequest) (int, []int) {
+		username, password, _ = r.BasicAuth()
+		contentType = r.Header.Get("Content-Type")
+		return http.StatusOK, nil
+	})
+
+	h, err := NewElasticsearchHandler(ElasticsearchConfig{
+		URL:           requests.url + "/",
+		Index:         "app-",
+		Username:      "elastic",
+		Password:      "secret",
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{
+		Level:      ERROR,
+		Time:       testRecordTime,
+		Message:    "something failed",
+		LoggerName: "payments",
+		Line:       42,
+		Baggage:    map[string]interface{}{"tenant": "acme"},
+	})
+	h.Handle(&Record{Level: INFO, Time: testRecordTime.Add(24 * time.Hour), Message: "next day"})
+	require.NoError(t, h.Flush())
+
+	assert.Equal(t, "elastic", username)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, "application/x-ndjson", contentType)
+
+	reqs := requests.get()
+	require.Len(t, reqs, 1)
+	assert.Equal(t, []map[string]map[string]string{
+		{"index": {"_index": "app-2018.06.11"}},
+		{"index": {"_index": "app-2018.06.12"}},
+	}, reqs[0].actions)
+	assert.Equal(t, map[string]interface{}{
+		"@timestamp": "2018-06-11T12:35:18.123456Z",
+		"message":    "something failed",
+		"level":      "ERROR",
+		"logger":     "payments",
+		"file":       "",
+		"line":       42.0,
+		"process":    "",
+		"pid":        0.0,
+		"tenant":     "acme",
+	}, reqs[0].docs[0])
+	assert.Equal(t, "next day", reqs[0].docs[1]["message"])
+	assert.Equal(t, ElasticsearchStats{Indexed: 2}, h.Stats())
+}
+
+func TestElasticsearchHandlerRetriesFailedDocuments(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	requests := serveElasticsearch(t, func(r *http.Request, req esBulkRequest) (int, []int) {
+		switch req.docs[0]["message"] {
+		case "first":
+			return http.StatusOK, []int{201, 429, 400}
+		default:
+			return http.StatusOK, []int{201}
+		}
+	})
+
+	h, err := NewElasticsearchHandler(ElasticsearchConfig{URL: requests.url, FlushInterval: time.Hour, RetryWait: time.Millisecond})
+	require.NoError(t, err)
+	defer h.Close()
+
+	for _, message := range []string{"first", "second", "third"} {
+		h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: message})
+	}
+	require.NoError(t, h.Flush())
+
+	reqs := requests.get()
+	require.Len(t, reqs, 2)
+	require.Len(t, reqs[1].docs, 1)
+	assert.Equal(t, "second", reqs[1].docs[0]["message"])
+	assert.Equal(t, ElasticsearchStats{Indexed: 2, Failed: 1, Retried: 1}, h.Stats())
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "can't index 1 records in Elasticsearch: status 400: mapper_parsing_exception")
+}
+
+func TestElasticsearchHandlerRetriesRequests(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	statuses := []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+	requests := serveElasticsearch(t, func(r *http.Request, req esBulkRequest) (int, []int) {
+		status := statuses[0]
+		statuses = statuses[1:]
+		return status, nil
+	})
+
+	h, err := NewElasticsearchHandler(ElasticsearchConfig{URL: requests.url, FlushInterval: time.Hour, RetryWait: time.Millisecond, MaxRetries: 1})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "dropped"})
+	require.NoError(t, h.Flush())
+
+	assert.Len(t, requests.get(), 2)
+	assert.Equal(t, ElasticsearchStats{Failed: 1, Retried: 1}, h.Stats())
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "503 Service Unavailable")
+}
+
+type esRequests struct {
+	m    sync.Mutex
+	url  string
+	reqs []esBulkRequest
+}
+
+func (r *esRequests) get() []esBulkRequest {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.reqs
+}
+
+// serveElasticsearch starts a fake bulk API answering with the status and the item statuses
+// returned by respond, all the items are successful if the item statuses are nil.
+func serveElasticsearch(t *testing.T, respond func(*http.Request, esBulkRequest) (int, []int)) *esRequests {
+	requests := &esRequests{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.m.Lock()
+		defer requests.m.Unlock()
+		if !assert.Equal(t, "/_bulk", r.URL.Path) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req esBulkRequest
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			if i%2 == 0 {
+				var action map[string]map[string]string
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+				req.actions = append(req.actions, action)
+			} else {
+				var doc map[string]interface{}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+				req.docs = append(req.docs, doc)
+			}
+		}
+		requests.reqs = append(requests.reqs, req)
+
+		status, items := respond(r, req)
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			fmt.Fprint(w, `{"error":"unavailable"}`)
+			return
+		}
+		if items == nil {
+			items = make([]int, len(req.docs))
+			for i := range items {
+				items[i] = 201
+			}
+		}
+		var responses []string
+		errors := false
+		for _, status := range items {
+			if status/100 == 2 {
+				responses = append(responses, fmt.Sprintf(`{"index":{"status":%d}}`, status))
+				continue
+			}
+			errors = true
+			responses = append(responses, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`, status))
+		}
+		fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, errors, strings.Join(responses, ","))
+	}))
+	t.Cleanup(server.Close)
+	requests.url = server.URL
+	return requests
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxErrorCauses is the maximum number of causes walked in an error chain.
+const maxErrorCauses = 32
+
+// ErrorLogger is implemented by loggers that can attach errors to their records, like the
+// ones created with NewLogger or returned by For. It's not part of Logger so existing
+// implementations of Logger don't need to implement it.
+type ErrorLogger interface {
+	// WithError returns a Logger that attaches the given error, and the chain
+	// of errors it wraps, to the records it logs.
+	WithError(err error) Logger
+}
+
+// withError returns l attaching err to its records if it implements ErrorLogger, or l otherwise.
+func withError(l Logger, err error) Logger {
+	if e, ok := l.(ErrorLogger); ok {
+		return e.WithError(err)
+	}
+	return l
+}
+
+// ErrorFielder is implemented by errors that carry key-value metadata to be logged with them.
+type ErrorFielder interface {
+	ErrorFields() map[string]interface{}
+}
+
+// ErrorCallers is implemented by errors that carry the stack where they were created,
+// as the program counters returned by runtime.Callers.
+type ErrorCallers interface {
+	Callers() []uintptr
+}
+
+// ErrorCause describes a single error of a chain of wrapped errors.
+type ErrorCause struct {
+	Type    string                 `json:"type"`             // Go type of the error, like "*os.PathError"
+	Message string                 `json:"message"`          // Error message
+	Fields  map[string]interface{} `json:"fields,omitempty"` // Metadata of errors implementing ErrorFielder
+	Stack   Stack                  `json:"stack,omitempty"`  // Stack of errors implementing ErrorCallers
+}
+
+// errorCauses walks the chain of errors wrapped by err, depth first,
+// following both Unwrap() error and Unwrap() []error methods.
+func errorCauses(err error) []ErrorCause {
+	var causes []ErrorCause
+	pending := []error{err}
+	for len(pending) > 0 && len(causes) < maxErrorCauses {
+		err, pending = pending[0], pending[1:]
+		if err == nil {
+			continue
+		}
+		if isNilPointer(err) {
+			// Typed nil errors may panic when calling their methods, and wrap nothing.
+			causes = append(causes, ErrorCause{Type: fmt.Sprintf("%T", err), Message: "<nil>"})
+			continue
+		}
+		causes = append(causes, newErrorCause(err))
+
+		switch wrapper := err.(type) {
+		case interface{ Unwrap() error }:
+			pending = append([]error{wrapper.Unwrap()}, pending...)
+		case interface{ Unwrap() []error }:
+			pending = append(append([]error{}, wrapper.Unwrap()...), pending...)
+		}
+	}
+	return causes
+}
+
+func newErrorCause(err error) ErrorCause {
+	cause := ErrorCause{
+		Type:    fmt.Sprintf("%T", err),
+		Message: err.Error(),
+	}
+	if fielder, ok := err.(ErrorFielder); ok {
+		cause.Fields = fielder.ErrorFields()
+	}
+	if callers, ok := err.(ErrorCallers); ok {
+		cause.Stack = stackFromPCs(callers.Callers())
+	}
+	return cause
+}
+
+// isNilPointer returns whether err is a nil pointer stored in a non nil error interface.
+func isNilPointer(err error) bool {
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// String returns the cause as "type: message key=value ...", followed by the indented stack if any.
+func (c ErrorCause) String() string {
+	var b strings.Builder
+	b.WriteString(c.Type)
+	b.WriteString(": ")
+	b.WriteString(c.Message)
+
+	keys := make([]string, 0, len(c.Fields))
+	for key := range c.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, c.Fields[key])
+	}
+
+	if len(c.Stack) > 0 {
+		b.WriteString("\n\t")
+		b.WriteString(strings.Replace(c.Stack.String(), "\n", "\n\t", -1))
+	}
+	return b.String()
+}
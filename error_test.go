@@ -0,0 +1,107 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fieldsError struct{ code int }
+
+func (e fieldsError) Error() string { return "failed" }
+func (e fieldsError) ErrorFields() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+type stackError struct{ pcs []uintptr }
+
+func newStackError() stackError {
+	pcs := make([]uintptr, 8)
+	return stackError{pcs: pcs[:runtime.Callers(1, pcs)]}
+}
+
+func (e stackError) Error() string      { return "with stack" }
+func (e stackError) Callers() []uintptr { return e.pcs }
+
+type joinedError []error
+
+func (e joinedError) Error() string   { return "joined" }
+func (e joinedError) Unwrap() []error { return e }
+
+func TestWithErrorAttachesErrorChain(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+
+	err := fmt.Errorf("loading: %w", joinedError{fieldsError{code: 42}, newStackError()})
+	l.(ErrorLogger).WithError(err).Error("something failed")
+	l.Error("no error")
+
+	require.Len(t, records, 2)
+	assert.Empty(t, records[1].Errors)
+
+	causes := records[0].Errors
+	require.Len(t, causes, 4)
+	assert.Equal(t, "*fmt.wrapError", causes[0].Type)
+	assert.Equal(t, "loading: joined", causes[0].Message)
+	assert.Equal(t, "log.joinedError", causes[1].Type)
+	assert.Equal(t, "log.fieldsError", causes[2].Type)
+	assert.Equal(t, map[string]interface{}{"code": 42}, causes[2].Fields)
+	assert.Equal(t, "log.stackError", causes[3].Type)
+	require.NotEmpty(t, causes[3].Stack)
+	assert.Equal(t, "github.com/cabify/go-logging.newStackError", causes[3].Stack[0].Function)
+}
+
+type pointerError struct{ message string }
+
+func (e *pointerError) Error() string { return e.message }
+
+func TestWithErrorHandlesTypedNilErrors(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+
+	var err *pointerError
+	l.(ErrorLogger).WithError(fmt.Errorf("loading: %w", err)).Error("something failed")
+
+	require.Len(t, records, 1)
+	require.Len(t, records[0].Errors, 2)
+	assert.Equal(t, ErrorCause{Type: "*log.pointerError", Message: "<nil>"}, records[0].Errors[1])
+}
+
+func TestWithErrorKeepsWrappers(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	l.SetLevel(DEBUG)
+
+	NoDebugLogger{Logger: l}.WithError(errors.New("boom")).Debug("discarded")
+	Factory{baseLogger: l}.For(WithBaggageValue(context.Background(), "key", "value")).(ErrorLogger).WithError(errors.New("boom")).Info("logged")
+
+	require.Len(t, records, 1)
+	assert.Equal(t, "key:value: logged", records[0].Message)
+	require.Len(t, records[0].Errors, 1)
+}
+
+func TestDefaultFormatterRendersErrorChain(t *testing.T) {
+	rec := &Record{
+		Level:   ERROR,
+		Message: "something failed",
+		Errors: []ErrorCause{
+			{Type: "*fmt.wrapError", Message: "loading: failed"},
+			{Type: "log.fieldsError", Message: "failed", Fields: map[string]interface{}{"code": 42, "a": "b"}},
+		},
+	}
+
+	lines := strings.Split(DefaultFormatter.Format(rec), "\n")
+	assert.Equal(t, []string{
+		"\terror: *fmt.wrapError: loading: failed",
+		"\tcaused by: log.fieldsError: failed a=b code=42",
+	}, lines[1:])
+}
@@ -0,0 +1,626 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v2"
+)
+
+// FileConfig is the declarative logging configuration of ConfigureFromFile, with named
+// formatters and handlers, and the handlers and levels of loggers. In JSON or YAML files,
+// like:
+//
+//	formatters:
+//	  json: {type: json, utc: true}
+//	handlers:
+//	  console: {type: stdout, formatter: json}
+//	  alerts: {type: webhook, level: critical, options: {url: "https://hooks.example.com/...", template: slack}}
+//	  all: {type: multi, options: {handlers: [console, alerts]}}
+//	root: {level: info, handler: all}
+//	loggers:
+//	  payments: {level: debug}
+//	  http.client: {level: warning, handler: console}
+type FileConfig struct {
+	// Name is the name of DefaultLogger, the process name by default.
+	Name string
+	// Formatters are the formatters of handlers by name.
+	Formatters map[string]FormatterConfig
+	// Handlers are the handlers of loggers by name.
+	Handlers map[string]HandlerConfig
+	// Root configures the loggers without bindings in Loggers, DefaultLogger included.
+	Root LoggerConfig
+	// Loggers bind the loggers whose names start with the keys, the longest prefix winning.
+	Loggers map[string]LoggerConfig
+}
+
+// FormatterConfig configures a formatter of a FileConfig.
+type FormatterConfig struct {
+	// Type is "default" or "json".
+	Type string
+	// TimeLayout is "default", "rfc3339", "rfc3339nano", "epochmillis" or any layout
+	// accepted by time.Format, the default one of the type if empty.
+	TimeLayout string
+	// UTC formats times in UTC instead of local time.
+	UTC bool
+}
+
+// HandlerConfig configures a handler of a FileConfig.
+//
+// Type is one of "stdout", "stderr", "file", "net", "syslog", "gelf", "fluent", "loki",
+// "elasticsearch", "otlp", "webhook" and "smtp", whose options are the fields of the config
+// of the handler in snake case, like "batch_size", with durations like "1.5s". The "file"
+// handler writes to the "path" option, and handlers connecting with TLS read the "tls", "ca_file",
+// "cert_file" and "key_file" options. With any of them, "syslog" handlers with the "tcp" network
+// connect with TLS, and other networks are rejected.
+//
+// Handlers are composed with the types "multi", sending records to the "handlers" option,
+// and the decorators of the "handler" option "filter", with an "expression" parsed with
+// ParsePredicate, "async", with a "queue_size", "sampling", emitting one of "every" records,
+// and "flight_recorder", with a ring of "size" records, DefaultFlightRecorderSize if unset,
+// and a "trigger" level, buffering the records below its level, the root level by default.
+type HandlerConfig struct {
+	Type string
+	// Level of the handler. Leaf handlers without level emit all the records of their loggers.
+	Level string
+	// Formatter is the name of a formatter, or "default" or "json", the default formatter if empty.
+	// The level and formatter of composed handlers replace the ones of the handlers they compose.
+	Formatter string
+	// Options of the handler type.
+	Options map[string]interface{}
+}
+
+// LoggerConfig configures the level and handler of loggers of a FileConfig.
+type LoggerConfig struct {
+	// Level of the loggers. Loggers bound in FileConfig.Loggers have the root level if empty.
+	Level string
+	// Handler is the name of the handler of the loggers, required in FileConfig.Root.
+	// Loggers bound in FileConfig.Loggers use the root handler if empty.
+	Handler string
+}
+
+// ConfigureFromFile configures DefaultLogger, DefaultHandler and the level spec of loggers
+// with the FileConfig in the JSON or YAML file at path. See ConfigureFromFileConfig.
+func ConfigureFromFile(path string) error {
+	cfg, err := LoadFileConfig(path)
+	if err != nil {
+		return err
+	}
+	return ConfigureFromFileConfig(cfg)
+}
+
+// ConfigureFromFileConfig validates cfg and builds its handlers. DefaultHandler is set to
+// a handler sending the records of each logger to its handler by name, so it's used by
+// the loggers created afterwards with NewLogger, and DefaultLogger is replaced with a logger
+// using it, as the base logger of DefaultFactory unless it was replaced with another
+// LoggerFactory. The levels of loggers are set with SetLevelSpec, and the handler is
+// registered to be closed on Exit.
+//
+// When called again, the handlers of the previous config are closed, and the loggers using
+// them send their records to the handlers of the new one. Handlers connecting to network
+// peers, like "net", "syslog", "gelf" and "fluent", dial them while building the config,
+// so it fails if they can't be reached.
+func ConfigureFromFileConfig(cfg FileConfig) error {
+	plans, err := cfg.validate()
+	if err != nil {
+		return err
+	}
+	handlers, err := cfg.build(plans)
+	if err != nil {
+		return err
+	}
+
+	bindings := &loggerBindings{root: handlers[cfg.Root.Handler], bindings: map[string]Handler{}}
+	spec := LevelSpec{Default: DefaultLevel, Overrides: map[string]Level{}}
+	if cfg.Root.Level != "" {
+		spec.Default = logLevelMap[strings.ToLower(cfg.Root.Level)]
+	}
+	for prefix, binding := range cfg.Loggers {
+		if binding.Handler != "" {
+			bindings.bindings[prefix] = handlers[binding.Handler]
+		}
+		if binding.Level != "" {
+			spec.Overrides[prefix] = logLevelMap[strings.ToLower(binding.Level)]
+		}
+	}
+
+	// The spec sets the level of the previous DefaultHandler, so it's set before replacing it.
+	SetLevelSpec(spec)
+	if handler, ok := configuredHandler.(*loggerBindingHandler); ok {
+		if err := handler.swap(bindings).Close(); err != nil {
+			OnHandlerError(fmt.Errorf("can't close the handlers of the previous log config: %v", err))
+		}
+		DefaultHandler = handler
+	} else {
+		handler := &loggerBindingHandler{}
+		handler.swap(bindings)
+		replaceRegisteredHandler(configuredHandler, handler)
+		configuredHandler = handler
+		DefaultHandler = handler
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = procName
+	}
+	setDefaultLogger(NewLogger(name))
+	return nil
+}
+
+// LoadFileConfig reads a FileConfig from a JSON or YAML file, see ParseFileConfig.
+func LoadFileConfig(path string) (FileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("can't read log config: %v", err)
+	}
+	cfg, err := ParseFileConfig(data)
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("invalid log config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseFileConfig parses and validates a FileConfig in JSON or YAML, whose keys are the
+// fields of the config in snake case, like "time_layout". All the errors are reported,
+// with the path of the invalid values, like "handlers.console.type: required".
+func ParseFileConfig(data []byte) (FileConfig, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return FileConfig{}, err
+	}
+	if doc == nil {
+		doc = map[interface{}]interface{}{}
+	}
+
+	errs := &configErrors{}
+	d := configDecoder{errs: errs}
+	fields := d.fields("", normalizeYAML(doc), "name", "formatters", "handlers", "root", "loggers")
+	cfg := FileConfig{
+		Name:    d.string("name", fields["name"]),
+		Root:    d.loggerConfig("root", fields["root"]),
+		Loggers: map[string]LoggerConfig{},
+	}
+	cfg.Formatters = map[string]FormatterConfig{}
+	formatters := d.mapping("formatters", fields["formatters"])
+	for _, name := range sortedKeys(formatters) {
+		path := "formatters." + name
+		f := d.fields(path, formatters[name], "type", "time_layout", "utc")
+		cfg.Formatters[name] = FormatterConfig{
+			Type:       d.string(path+".type", f["type"]),
+			TimeLayout: d.string(path+".time_layout", f["time_layout"]),
+			UTC:        d.bool(path+".utc", f["utc"]),
+		}
+	}
+	cfg.Handlers = map[string]HandlerConfig{}
+	handlers := d.mapping("handlers", fields["handlers"])
+	for _, name := range sortedKeys(handlers) {
+		path := "handlers." + name
+		f := d.fields(path, handlers[name], "type", "level", "formatter", "options")
+		cfg.Handlers[name] = HandlerConfig{
+			Type:      d.string(path+".type", f["type"]),
+			Level:     d.string(path+".level", f["level"]),
+			Formatter: d.string(path+".formatter", f["formatter"]),
+			Options:   d.mapping(path+".options", f["options"]),
+		}
+	}
+	loggers := d.mapping("loggers", fields["loggers"])
+	for _, prefix := range sortedKeys(loggers) {
+		cfg.Loggers[prefix] = d.loggerConfig("loggers."+prefix, loggers[prefix])
+	}
+
+	if _, err := cfg.validate(); err != nil {
+		errs.err = multierror.Append(errs.err, err)
+	}
+	if errs.err != nil {
+		return FileConfig{}, errs.err
+	}
+	return cfg, nil
+}
+
+// Validate checks the config, reporting all the errors with the path of the invalid values.
+// It doesn't open files nor connections.
+func (cfg FileConfig) Validate() error {
+	_, err := cfg.validate()
+	return err
+}
+
+func (cfg FileConfig) validate() (map[string]handlerPlan, error) {
+	errs := &configErrors{}
+
+	for _, name := range sortedKeys(cfg.Formatters) {
+		f := cfg.Formatters[name]
+		if f.Type != "default" && f.Type != "json" {
+			errs.add("formatters."+name+".type", `expected "default" or "json"`)
+		}
+		if name == "default" || name == "json" {
+			errs.add("formatters."+name, "reserved name")
+		}
+	}
+
+	// The root level is the DefaultLevel set when the config is applied, but handlers are
+	// built before, so the ones depending on it get it explicitly.
+	rootLevel := DefaultLevel
+	if level, ok := logLevelMap[strings.ToLower(cfg.Root.Level)]; ok {
+		rootLevel = level
+	}
+	plans := map[string]handlerPlan{}
+	for _, name := range sortedKeys(cfg.Handlers) {
+		h := cfg.Handlers[name]
+		path := "handlers." + name
+		if h.Level != "" {
+			validateLevel(errs, path+".level", h.Level)
+		}
+		if _, ok := cfg.Formatters[h.Formatter]; !ok && h.Formatter != "" && h.Formatter != "default" && h.Formatter != "json" {
+			errs.add(path+".formatter", "unknown formatter %q", h.Formatter)
+		}
+
+		handlerType, ok := handlerTypes[h.Type]
+		if !ok {
+			if h.Type == "" {
+				errs.add(path+".type", "required")
+			} else {
+				errs.add(path+".type", "unknown handler type %q", h.Type)
+			}
+			continue
+		}
+		options := &configOptions{path: path + ".options", values: h.Options, used: map[string]bool{}, errs: errs, rootLevel: rootLevel}
+		plan := handlerType(options)
+		options.checkUnused()
+		for _, child := range plan.children {
+			if _, ok := cfg.Handlers[child]; !ok && child != "" {
+				errs.add(path+".options", "unknown handler %q", child)
+			}
+		}
+		plans[name] = plan
+	}
+	for _, name := range sortedKeys(cfg.Handlers) {
+		if cycle := handlerCycle(plans, name, nil); cycle != nil {
+			errs.add("handlers."+name, "cycle of handlers %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if cfg.Root.Handler == "" {
+		errs.add("root.handler", "required")
+	}
+	validateLoggerConfig(errs, "root", cfg.Root, cfg.Handlers)
+	for _, prefix := range sortedKeys(cfg.Loggers) {
+		if prefix == "" {
+			errs.add("loggers", "empty logger name, use root")
+		}
+		validateLoggerConfig(errs, "loggers."+prefix, cfg.Loggers[prefix], cfg.Handlers)
+	}
+	return plans, errs.err
+}
+
+func validateLoggerConfig(errs *configErrors, path string, cfg LoggerConfig, handlers map[string]HandlerConfig) {
+	if cfg.Level != "" {
+		validateLevel(errs, path+".level", cfg.Level)
+	}
+	if _, ok := handlers[cfg.Handler]; !ok && cfg.Handler != "" {
+		errs.add(path+".handler", "unknown handler %q", cfg.Handler)
+	}
+}
+
+func validateLevel(errs *configErrors, path, level string) {
+	if _, ok := logLevelMap[strings.ToLower(level)]; !ok {
+		errs.add(path, "unknown log level %q", level)
+	}
+}
+
+// handlerCycle returns the cycle of handlers starting at name, if any.
+func handlerCycle(plans map[string]handlerPlan, name string, visiting []string) []string {
+	for i, visited := range visiting {
+		if visited == name {
+			if i == 0 {
+				return append(visiting, name)
+			}
+			// The cycle doesn't include the first handler, it's reported from its own start.
+			return nil
+		}
+	}
+	for _, child := range plans[name].children {
+		if cycle := handlerCycle(plans, child, append(visiting, name)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// build builds the handlers used by loggers, closing the ones already built if one fails.
+func (cfg FileConfig) build(plans map[string]handlerPlan) (map[string]Handler, error) {
+	names := []string{cfg.Root.Handler}
+	for _, prefix := range sortedKeys(cfg.Loggers) {
+		if handler := cfg.Loggers[prefix].Handler; handler != "" && handler != cfg.Root.Handler {
+			names = append(names, handler)
+		}
+	}
+	references := map[string]int{}
+	for _, name := range names {
+		references[name]++
+	}
+	for _, plan := range plans {
+		for _, child := range plan.children {
+			references[child]++
+		}
+	}
+
+	built := map[string]Handler{}
+	var buildHandler func(name string) (Handler, error)
+	buildHandler = func(name string) (Handler, error) {
+		if h, ok := built[name]; ok {
+			return h, nil
+		}
+		plan := plans[name]
+		children := make([]Handler, len(plan.children))
+		for i, child := range plan.children {
+			var err error
+			if children[i], err = buildHandler(child); err != nil {
+				return nil, err
+			}
+		}
+		h, err := plan.build(children)
+		if err != nil {
+			return nil, fmt.Errorf("handlers.%s: can't create handler: %v", name, err)
+		}
+
+		c := cfg.Handlers[name]
+		if c.Level != "" {
+			h.SetLevel(logLevelMap[strings.ToLower(c.Level)])
+		} else if len(plan.children) == 0 {
+			h.SetLevel(DEBUG)
+		}
+		if c.Formatter != "" {
+			h.SetFormatter(cfg.formatter(c.Formatter))
+		}
+		if references[name] > 1 {
+			// It's closed by each handler composing it, or binding it to loggers.
+			h = &sharedHandler{Handler: h}
+		}
+		built[name] = h
+		return h, nil
+	}
+
+	handlers := map[string]Handler{}
+	for _, name := range names {
+		h, err := buildHandler(name)
+		if err != nil {
+			for _, h := range built {
+				_ = h.Close()
+			}
+			return nil, err
+		}
+		handlers[name] = h
+	}
+	return handlers, nil
+}
+
+func (cfg FileConfig) formatter(name string) Formatter {
+	f, ok := cfg.Formatters[name]
+	if !ok {
+		f.Type = name
+	}
+	if f.Type == "json" {
+		layout := f.TimeLayout
+		if named, ok := timeLayoutNames[layout]; ok {
+			layout = named
+		}
+		return JSONFormatter{TimeLayout: layout, UTC: f.UTC}
+	}
+	return NewDefaultFormatter(getTimeLayout(f.TimeLayout), f.UTC)
+}
+
+// loggerBindingHandler sends the records to the handler bound to the longest prefix of their
+// logger name. Its bindings are replaced when a config is applied again, so the loggers
+// created with the previous one send their records to the new handlers.
+type loggerBindingHandler struct {
+	current atomic.Value // *loggerBindings
+}
+
+// loggerBindings are the handlers of the loggers by prefix of their names.
+type loggerBindings struct {
+	root     Handler
+	bindings map[string]Handler
+}
+
+// swap replaces the bindings of the handler, returning the previous ones.
+func (h *loggerBindingHandler) swap(bindings *loggerBindings) *loggerBindings {
+	previous, _ := h.current.Load().(*loggerBindings)
+	h.current.Store(bindings)
+	return previous
+}
+
+func (h *loggerBindingHandler) bindings() *loggerBindings {
+	return h.current.Load().(*loggerBindings)
+}
+
+func (b *loggerBindings) handlerFor(loggerName string) Handler {
+	handler, longest := b.root, -1
+	for prefix, bound := range b.bindings {
+		if hasNamePrefix(loggerName, prefix) && len(prefix) > longest {
+			handler, longest = bound, len(prefix)
+		}
+	}
+	return handler
+}
+
+// handlers returns the distinct handlers of the bindings.
+func (b *loggerBindings) handlers() []Handler {
+	handlers := []Handler{b.root}
+	for _, prefix := range sortedKeys(b.bindings) {
+		bound := b.bindings[prefix]
+		duplicated := false
+		for _, handler := range handlers {
+			duplicated = duplicated || handler == bound
+		}
+		if !duplicated {
+			handlers = append(handlers, bound)
+		}
+	}
+	return handlers
+}
+
+func (b *loggerBindings) Close() error {
+	var result error
+	for _, handler := range b.handlers() {
+		if err := handler.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+func (h *loggerBindingHandler) Handle(rec *Record) {
+	h.bindings().handlerFor(rec.LoggerName).Handle(rec)
+}
+
+// SetFormatter sets the formatter of the bound handlers, replacing the ones of the config.
+func (h *loggerBindingHandler) SetFormatter(f Formatter) {
+	for _, handler := range h.bindings().handlers() {
+		handler.SetFormatter(f)
+	}
+}
+
+// SetLevel sets the level of the bound handlers, replacing the ones of the config.
+func (h *loggerBindingHandler) SetLevel(l Level) {
+	for _, handler := range h.bindings().handlers() {
+		handler.SetLevel(l)
+	}
+}
+
+func (h *loggerBindingHandler) Flush() error {
+	return flushHandlers(h.bindings().handlers())
+}
+
+func (h *loggerBindingHandler) Close() error {
+	return h.bindings().Close()
+}
+
+// sharedHandler decorates a handler used more than once in a FileConfig, closing it only once.
+type sharedHandler struct {
+	Handler
+	close sync.Once
+	err   error
+}
+
+func (h *sharedHandler) Close() error {
+	h.close.Do(func() { h.err = h.Handler.Close() })
+	return h.err
+}
+
+// Flush flushes the decorated handler if it implements Flusher.
+func (h *sharedHandler) Flush() error {
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// configErrors collects the errors of a config with their paths.
+type configErrors struct {
+	err error
+}
+
+func (e *configErrors) add(path, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if path != "" {
+		message = path + ": " + message
+	}
+	e.err = multierror.Append(e.err, errors.New(message))
+}
+
+// configDecoder reads the values of a parsed FileConfig, reporting the errors with their paths.
+type configDecoder struct {
+	errs *configErrors
+}
+
+// fields returns the fields of a mapping, reporting the unknown ones.
+func (d configDecoder) fields(path string, v interface{}, known ...string) map[string]interface{} {
+	m := d.mapping(path, v)
+	for _, key := range sortedKeys(m) {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			d.errs.add(strings.TrimPrefix(path+"."+key, "."), "unknown field")
+		}
+	}
+	return m
+}
+
+func (d configDecoder) mapping(path string, v interface{}) map[string]interface{} {
+	if v == nil {
+		return nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		d.errs.add(path, "expected a mapping")
+	}
+	return m
+}
+
+func (d configDecoder) string(path string, v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		d.errs.add(path, "expected a string")
+	}
+	return s
+}
+
+func (d configDecoder) bool(path string, v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		d.errs.add(path, "expected a boolean")
+	}
+	return b
+}
+
+func (d configDecoder) loggerConfig(path string, v interface{}) LoggerConfig {
+	f := d.fields(path, v, "level", "handler")
+	return LoggerConfig{
+		Level:   d.string(path+".level", f["level"]),
+		Handler: d.string(path+".handler", f["handler"]),
+	}
+}
+
+// normalizeYAML converts the mappings decoded by yaml to map[string]interface{}, like the JSON ones.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(value)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of a map with string keys, sorted, so errors are reported in order.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
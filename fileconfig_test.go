@@ -0,0 +1,282 @@
+package log
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFileConfig = `
+name: app
+formatters:
+  plain: {type: default, time_layout: rfc3339, utc: true}
+handlers:
+  app:
+    type: file
+    formatter: plain
+    options: {path: %s/app.log}
+  errors:
+    type: file
+    level: error
+    formatter: json
+    options: {path: %s/errors.log}
+  all:
+    type: multi
+    options: {handlers: [app, errors]}
+  quiet:
+    type: filter
+    options: {handler: all, expression: 'not message ~ "^health"'}
+  payments:
+    type: async
+    options: {handler: app, queue_size: 10}
+root: {level: info, handler: quiet}
+loggers:
+  payments: {level: debug, handler: payments}
+  http.client: {level: warning}
+`
+
+func TestParseFileConfig(t *testing.T) {
+	cfg, err := ParseFileConfig([]byte(strings.Replace(testFileConfig, "%s", "/var/log", -1)))
+	require.NoError(t, err)
+
+	assert.Equal(t, "app", cfg.Name)
+	assert.Equal(t, map[string]FormatterConfig{"plain": {Type: "default", TimeLayout: "rfc3339", UTC: true}}, cfg.Formatters)
+	assert.Equal(t, HandlerConfig{
+		Type:      "file",
+		Level:     "error",
+		Formatter: "json",
+		Options:   map[string]interface{}{"path": "/var/log/errors.log"},
+	}, cfg.Handlers["errors"])
+	assert.Equal(t, []interface{}{"app", "errors"}, cfg.Handlers["all"].Options["handlers"])
+	assert.Equal(t, LoggerConfig{Level: "info", Handler: "quiet"}, cfg.Root)
+	assert.Equal(t, map[string]LoggerConfig{
+		"payments":    {Level: "debug", Handler: "payments"},
+		"http.client": {Level: "warning"},
+	}, cfg.Loggers)
+}
+
+func TestParseFileConfigJSON(t *testing.T) {
+	cfg, err := ParseFileConfig([]byte(`{
+		"handlers": {"console": {"type": "stdout", "options": {}}},
+		"root": {"handler": "console"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "stdout", cfg.Handlers["console"].Type)
+	assert.Equal(t, "console", cfg.Root.Handler)
+}
+
+func TestParseFileConfigReportsAllErrors(t *testing.T) {
+	_, err := ParseFileConfig([]byte(`
+unknown: true
+formatters:
+  plain: {type: xml, color: true}
+handlers:
+  console: {type: stdout, level: loud, formatter: fancy}
+  remote: {type: net, options: {address: 3, framing: crlf, write_timeout: soon, retries: 2}}
+  filtered: {type: filter, options: {handler: missing, expression: "level >"}}
+  a: {type: multi, options: {handlers: [b]}}
+  b: {type: async, options: {handler: a}}
+  untyped: {}
+root: {level: info}
+loggers:
+  payments: {handler: nowhere, level: verbose}
+`))
+	require.Error(t, err)
+	for _, msg := range []string{
+		"unknown: unknown field",
+		"formatters.plain.color: unknown field",
+		`formatters.plain.type: expected "default" or "json"`,
+		`handlers.console.level: unknown log level "loud"`,
+		`handlers.console.formatter: unknown formatter "fancy"`,
+		"handlers.remote.options.network: required",
+		"handlers.remote.options.address: expected a string",
+		"handlers.remote.options.framing: expected one of newline, length_prefix",
+		`handlers.remote.options.write_timeout: expected a duration like "1.5s"`,
+		"handlers.remote.options.retries: unknown option",
+		`handlers.filtered.options: unknown handler "missing"`,
+		`handlers.filtered.options.expression: invalid filter expression "level >": missing value at the end`,
+		"handlers.a: cycle of handlers a -> b -> a",
+		"handlers.b: cycle of handlers b -> a -> b",
+		"handlers.untyped.type: required",
+		"root.handler: required",
+		`loggers.payments.level: unknown log level "verbose"`,
+		`loggers.payments.handler: unknown handler "nowhere"`,
+	} {
+		assert.Contains(t, err.Error(), "* "+msg+"\n")
+	}
+	assert.Equal(t, 18, strings.Count(err.Error(), "* "), err.Error())
+}
+
+func TestConfigureFromFile(t *testing.T) {
+	defer func(level Level, restore func()) {
+		restore()
+		setLevelOverrides(nil)
+		SetLevel(level)
+		DefaultLevel = level
+	}(DefaultLevel, restoreShutdownState())
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Replace(testFileConfig, "%s", dir, -1)), 0644))
+	require.NoError(t, ConfigureFromFile(path))
+
+	Debug("filtered by the root level")
+	Info("health check")
+	Info("info")
+	Error("error")
+	payments := NewLogger("payments.http")
+	payments.Debug("payments debug")
+	client := NewLogger("http.client")
+	client.Info("filtered by the logger level")
+	client.Warning("client warning")
+	require.NoError(t, FlushTimeout(time.Second))
+
+	app, err := ioutil.ReadFile(filepath.Join(dir, "app.log"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(app), "\n"), string(app))
+	assert.Contains(t, string(app), "Z [app] INFO     info\n")
+	assert.Contains(t, string(app), "Z [app] ERROR    error\n")
+	assert.Contains(t, string(app), "Z [payments.http] DEBUG    payments debug\n")
+	assert.Contains(t, string(app), "Z [http.client] WARNING  client warning\n")
+
+	errors, err := ioutil.ReadFile(filepath.Join(dir, "errors.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(errors), `"message":"error"`)
+	assert.Equal(t, 1, strings.Count(string(errors), "\n"))
+
+	assert.Equal(t, map[string]Level{"": INFO, "payments": DEBUG, "http.client": WARNING}, EffectiveLevels())
+	assert.NoError(t, LoggerHandler(DefaultLogger).Close(), "handlers used twice are closed once")
+}
+
+func TestConfigureFromFileFailsCreatingHandlers(t *testing.T) {
+	err := ConfigureFromFileConfig(FileConfig{
+		Handlers: map[string]HandlerConfig{
+			"file": {Type: "file", Options: map[string]interface{}{"path": filepath.Join(t.TempDir(), "missing", "app.log")}},
+		},
+		Root: LoggerConfig{Handler: "file"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "handlers.file: can't create handler: open ")
+}
+
+func TestConfigureFromFileConfigReplacesThePreviousConfig(t *testing.T) {
+	defer func(level Level, restore func()) {
+		restore()
+		setLevelOverrides(nil)
+		SetLevel(level)
+		DefaultLevel = level
+	}(DefaultLevel, restoreShutdownState())
+
+	dir := t.TempDir()
+	fileConfig := func(name string) FileConfig {
+		return FileConfig{
+			Name: "app",
+			Handlers: map[string]HandlerConfig{
+				"file": {Type: "file", Formatter: "plain", Options: map[string]interface{}{"path": filepath.Join(dir, name)}},
+			},
+			Formatters: map[string]FormatterConfig{"plain": {Type: "default", TimeLayout: "rfc3339", UTC: true}},
+			Root:       LoggerConfig{Level: "info", Handler: "file"},
+		}
+	}
+	require.NoError(t, ConfigureFromFileConfig(fileConfig("first.log")))
+	registered := len(registry.handlers)
+	previous := NewLogger("previous")
+
+	require.NoError(t, ConfigureFromFileConfig(fileConfig("second.log")))
+	assert.Len(t, registry.handlers, registered, "the previous handler is replaced")
+	previous.Info("previous logger")
+	For(context.Background()).Info("factory logger")
+	DefaultHandler.SetLevel(ERROR)
+	Warning("filtered by the handler level")
+	require.NoError(t, FlushTimeout(time.Second))
+
+	first, err := ioutil.ReadFile(filepath.Join(dir, "first.log"))
+	require.NoError(t, err)
+	assert.Empty(t, string(first))
+	second, err := ioutil.ReadFile(filepath.Join(dir, "second.log"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(second), "\n"), string(second))
+	assert.Contains(t, string(second), "Z [previous] INFO     previous logger\n")
+	assert.Contains(t, string(second), "Z [app] INFO     factory logger\n")
+}
+
+func TestFileConfigSyslogWithTLS(t *testing.T) {
+	serverTLS, _ := newTestTLSConfigs(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverTLS.Certificates[0].Certificate[0]})
+	require.NoError(t, ioutil.WriteFile(caFile, ca, 0644))
+
+	for _, network := range []string{"tcp", "tls"} {
+		t.Run(network, func(t *testing.T) {
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", serverTLS)
+			require.NoError(t, err)
+			defer listener.Close()
+			messages := acceptSyslogMessages(t, listener, OctetCounting)
+
+			cfg := FileConfig{
+				Handlers: map[string]HandlerConfig{
+					"syslog": {Type: "syslog", Options: map[string]interface{}{
+						"network":  network,
+						"address":  listener.Addr().String(),
+						"tls":      true,
+						"ca_file":  caFile,
+						"hostname": "host",
+						"app_name": "app",
+					}},
+				},
+				Root: LoggerConfig{Handler: "syslog"},
+			}
+			plans, err := cfg.validate()
+			require.NoError(t, err)
+			handlers, err := cfg.build(plans)
+			require.NoError(t, err)
+			h := handlers["syslog"]
+			defer h.Close()
+			h.SetFormatter(messageFormatter{})
+
+			h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "encrypted", ProcessID: 1})
+			assert.Equal(t, "<11>1 2018-06-11T12:35:18.123456Z host app 1 - - encrypted", <-messages)
+		})
+	}
+}
+
+func TestFileConfigSyslogRejectsTLSWithoutTCP(t *testing.T) {
+	cfg := FileConfig{
+		Handlers: map[string]HandlerConfig{
+			"syslog": {Type: "syslog", Options: map[string]interface{}{"network": "udp", "address": "127.0.0.1:514", "tls": true}},
+		},
+		Root: LoggerConfig{Handler: "syslog"},
+	}
+	_, err := cfg.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `handlers.syslog.options.network: TLS options require the tcp or tls network, not "udp"`)
+}
+
+func TestFileConfigFlightRecorderHasTheRootLevel(t *testing.T) {
+	defer func(level Level) { DefaultLevel = level }(DefaultLevel)
+	DefaultLevel = INFO
+
+	cfg := FileConfig{
+		Handlers: map[string]HandlerConfig{
+			"console":  {Type: "stdout"},
+			"recorder": {Type: "flight_recorder", Options: map[string]interface{}{"handler": "console"}},
+		},
+		Root: LoggerConfig{Level: "warning", Handler: "recorder"},
+	}
+	plans, err := cfg.validate()
+	require.NoError(t, err)
+	handlers, err := cfg.build(plans)
+	require.NoError(t, err)
+
+	recorder, ok := handlers["recorder"].(*FlightRecorderHandler)
+	require.True(t, ok)
+	assert.Equal(t, WARNING, recorder.level)
+}
@@ -0,0 +1,492 @@
+package log
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// handlerPlan is a validated handler of a FileConfig, built once its children are built.
+type handlerPlan struct {
+	children []string
+	build    func(children []Handler) (Handler, error)
+}
+
+// handlerTypes are the handler types of FileConfig, with the functions reading their options.
+var handlerTypes = map[string]func(o *configOptions) handlerPlan{
+	"stdout":          fileHandlerType(os.Stdout),
+	"stderr":          fileHandlerType(os.Stderr),
+	"file":            filePathHandlerType,
+	"net":             netHandlerType,
+	"syslog":          syslogHandlerType,
+	"gelf":            gelfHandlerType,
+	"fluent":          fluentHandlerType,
+	"loki":            lokiHandlerType,
+	"elasticsearch":   elasticsearchHandlerType,
+	"otlp":            otlpHandlerType,
+	"webhook":         webhookHandlerType,
+	"smtp":            smtpHandlerType,
+	"multi":           multiHandlerType,
+	"filter":          filterHandlerType,
+	"async":           asyncHandlerType,
+	"sampling":        samplingHandlerType,
+	"flight_recorder": flightRecorderHandlerType,
+}
+
+func fileHandlerType(f *os.File) func(o *configOptions) handlerPlan {
+	return func(o *configOptions) handlerPlan {
+		return leafPlan(func() (Handler, error) { return NewFileHandler(f), nil })
+	}
+}
+
+func filePathHandlerType(o *configOptions) handlerPlan {
+	path := o.string("path", true)
+	return leafPlan(func() (Handler, error) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewFileHandler(f), nil
+	})
+}
+
+func netHandlerType(o *configOptions) handlerPlan {
+	cfg := NetConfig{
+		Network:      o.string("network", true),
+		Address:      o.string("address", true),
+		Framing:      NetFraming(o.choice("framing", "newline", "length_prefix")),
+		BufferSize:   o.int("buffer_size"),
+		DialTimeout:  o.duration("dial_timeout"),
+		WriteTimeout: o.duration("write_timeout"),
+		MinBackoff:   o.duration("min_backoff"),
+		MaxBackoff:   o.duration("max_backoff"),
+	}
+	tlsOptions, _ := o.tls()
+	return leafPlan(func() (Handler, error) {
+		var err error
+		if cfg.TLSConfig, err = tlsOptions(); err != nil {
+			return nil, err
+		}
+		return NewNetHandler(cfg)
+	})
+}
+
+// syslogFacilities are the facility names of syslog handlers, in the order of Facility.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp",
+	"ntp", "security", "console", "solaris-cron", "local0", "local1", "local2", "local3", "local4",
+	"local5", "local6", "local7",
+}
+
+func syslogHandlerType(o *configOptions) handlerPlan {
+	var facility Facility
+	if o.string("facility", false) != "" {
+		facility = FacilityKern + Facility(o.choice("facility", syslogFacilities...))
+	}
+	cfg := RFC5424Config{
+		Network:          o.string("network", true),
+		Address:          o.string("address", true),
+		Framing:          SyslogFraming(o.choice("framing", "octet_counting", "non_transparent")),
+		Facility:         facility,
+		Hostname:         o.string("hostname", false),
+		AppName:          o.string("app_name", false),
+		MsgID:            o.string("msg_id", false),
+		StructuredDataID: o.string("structured_data_id", false),
+		DialTimeout:      o.duration("dial_timeout"),
+		WriteTimeout:     o.duration("write_timeout"),
+	}
+	tlsOptions, tlsEnabled := o.tls()
+	if tlsEnabled {
+		// RFC5424Handler only uses the TLS config with the "tls" network, so TLS options
+		// can't be silently ignored by plain connections.
+		switch cfg.Network {
+		case "tcp":
+			cfg.Network = "tls"
+		case "tls":
+		default:
+			o.errorf("network", "TLS options require the tcp or tls network, not %q", cfg.Network)
+		}
+	}
+	return leafPlan(func() (Handler, error) {
+		var err error
+		if cfg.TLSConfig, err = tlsOptions(); err != nil {
+			return nil, err
+		}
+		return NewRFC5424Handler(cfg)
+	})
+}
+
+func gelfHandlerType(o *configOptions) handlerPlan {
+	cfg := GELFConfig{
+		Network:      o.string("network", true),
+		Address:      o.string("address", true),
+		Compression:  GELFCompression(o.choice("compression", "gzip", "zlib", "none")),
+		ChunkSize:    o.int("chunk_size"),
+		Host:         o.string("host", false),
+		DialTimeout:  o.duration("dial_timeout"),
+		WriteTimeout: o.duration("write_timeout"),
+	}
+	return leafPlan(func() (Handler, error) { return NewGELFHandler(cfg) })
+}
+
+func fluentHandlerType(o *configOptions) handlerPlan {
+	cfg := FluentConfig{
+		Network:       o.string("network", false),
+		Address:       o.string("address", true),
+		Tag:           o.string("tag", true),
+		Mode:          FluentMode(o.choice("mode", "forward", "packed_forward")),
+		BatchSize:     o.int("batch_size"),
+		FlushInterval: o.duration("flush_interval"),
+		RequireAck:    o.bool("require_ack"),
+		AckTimeout:    o.duration("ack_timeout"),
+		MaxRetries:    o.int("max_retries"),
+		RetryWait:     o.duration("retry_wait"),
+		DialTimeout:   o.duration("dial_timeout"),
+		WriteTimeout:  o.duration("write_timeout"),
+	}
+	return leafPlan(func() (Handler, error) { return NewFluentHandler(cfg) })
+}
+
+func lokiHandlerType(o *configOptions) handlerPlan {
+	cfg := LokiConfig{
+		URL:           o.string("url", true),
+		TenantID:      o.string("tenant_id", false),
+		Labels:        o.stringMap("labels"),
+		BaggageLabels: o.strings("baggage_labels"),
+		Encoding:      LokiEncoding(o.choice("encoding", "json", "protobuf")),
+		BatchSize:     o.int("batch_size"),
+		BatchWait:     o.duration("batch_wait"),
+		MaxRetries:    o.int("max_retries"),
+		MinBackoff:    o.duration("min_backoff"),
+		MaxBackoff:    o.duration("max_backoff"),
+	}
+	return leafPlan(func() (Handler, error) { return NewLokiHandler(cfg) })
+}
+
+func elasticsearchHandlerType(o *configOptions) handlerPlan {
+	cfg := ElasticsearchConfig{
+		URL:             o.string("url", true),
+		Index:           o.string("index", false),
+		IndexDateLayout: o.string("index_date_layout", false),
+		Username:        o.string("username", false),
+		Password:        o.string("password", false),
+		BatchSize:       o.int("batch_size"),
+		FlushInterval:   o.duration("flush_interval"),
+		MaxRetries:      o.int("max_retries"),
+		RetryWait:       o.duration("retry_wait"),
+	}
+	return leafPlan(func() (Handler, error) { return NewElasticsearchHandler(cfg) })
+}
+
+func otlpHandlerType(o *configOptions) handlerPlan {
+	cfg := OTLPConfig{
+		Endpoint:           o.string("endpoint", true),
+		Encoding:           OTLPEncoding(o.choice("encoding", "protobuf", "json")),
+		Headers:            o.stringMap("headers"),
+		ResourceAttributes: o.stringMap("resource_attributes"),
+		BatchSize:          o.int("batch_size"),
+		FlushInterval:      o.duration("flush_interval"),
+		MaxRetries:         o.int("max_retries"),
+		MinBackoff:         o.duration("min_backoff"),
+		MaxBackoff:         o.duration("max_backoff"),
+	}
+	return leafPlan(func() (Handler, error) { return NewOTLPHandler(cfg) })
+}
+
+func webhookHandlerType(o *configOptions) handlerPlan {
+	cfg := WebhookConfig{
+		URL:                o.string("url", true),
+		Template:           o.string("template", false),
+		Headers:            o.stringMap("headers"),
+		Interval:           o.duration("interval"),
+		MaxAlertsPerHour:   o.int("max_alerts_per_hour"),
+		MaxRecordsPerAlert: o.int("max_records_per_alert"),
+	}
+	switch cfg.Template {
+	case "slack":
+		cfg.Template = SlackWebhookTemplate
+	case "generic":
+		cfg.Template = GenericWebhookTemplate
+	}
+	return leafPlan(func() (Handler, error) { return NewWebhookHandler(cfg) })
+}
+
+func smtpHandlerType(o *configOptions) handlerPlan {
+	cfg := SMTPConfig{
+		Address:     o.string("address", true),
+		Username:    o.string("username", false),
+		Password:    o.string("password", false),
+		Auth:        SMTPAuth(o.choice("auth", "plain", "login")),
+		RequireTLS:  o.bool("require_tls"),
+		From:        o.string("from", true),
+		To:          o.strings("to"),
+		Subject:     o.string("subject", false),
+		QuietPeriod: o.duration("quiet_period"),
+		MaxDelay:    o.duration("max_delay"),
+		MaxRecords:  o.int("max_records"),
+		Timeout:     o.duration("timeout"),
+	}
+	if len(cfg.To) == 0 {
+		o.errorf("to", "required")
+	}
+	return leafPlan(func() (Handler, error) { return NewSMTPHandler(cfg) })
+}
+
+func multiHandlerType(o *configOptions) handlerPlan {
+	children := o.strings("handlers")
+	if len(children) == 0 {
+		o.errorf("handlers", "required")
+	}
+	return handlerPlan{
+		children: children,
+		build: func(children []Handler) (Handler, error) {
+			return NewMultiHandler(children...), nil
+		},
+	}
+}
+
+func filterHandlerType(o *configOptions) handlerPlan {
+	child := o.string("handler", true)
+	expression := o.string("expression", true)
+	predicate, err := ParsePredicate(expression)
+	if err != nil && expression != "" {
+		o.errorf("expression", "%v", err)
+	}
+	return decoratorPlan(child, func(handler Handler) Handler {
+		return NewFilterHandler(handler, predicate)
+	})
+}
+
+func asyncHandlerType(o *configOptions) handlerPlan {
+	child := o.string("handler", true)
+	size := o.int("queue_size")
+	return decoratorPlan(child, func(handler Handler) Handler {
+		return NewAsyncHandler(handler, size)
+	})
+}
+
+func samplingHandlerType(o *configOptions) handlerPlan {
+	child := o.string("handler", true)
+	n := o.int("every")
+	if n <= 0 {
+		o.errorf("every", "must be a positive number")
+	}
+	return decoratorPlan(child, func(handler Handler) Handler {
+		return NewSamplingHandler(handler, n)
+	})
+}
+
+func flightRecorderHandlerType(o *configOptions) handlerPlan {
+	child := o.string("handler", true)
+	size := o.int("size")
+	if size < 0 {
+		o.errorf("size", "can't be negative")
+	}
+	trigger := ERROR
+	if name := o.string("trigger", false); name != "" {
+		trigger = o.level("trigger", name)
+	}
+	level := o.rootLevel
+	return decoratorPlan(child, func(handler Handler) Handler {
+		h := NewFlightRecorderHandler(handler, size, trigger)
+		h.SetLevel(level)
+		return h
+	})
+}
+
+func leafPlan(build func() (Handler, error)) handlerPlan {
+	return handlerPlan{build: func([]Handler) (Handler, error) { return build() }}
+}
+
+func decoratorPlan(child string, decorate func(Handler) Handler) handlerPlan {
+	return handlerPlan{
+		children: []string{child},
+		build: func(children []Handler) (Handler, error) {
+			return decorate(children[0]), nil
+		},
+	}
+}
+
+// configOptions reads the options of a handler, reporting the errors with their paths.
+type configOptions struct {
+	path      string
+	values    map[string]interface{}
+	used      map[string]bool
+	errs      *configErrors
+	rootLevel Level // Level of FileConfig.Root, DefaultLevel if not set
+}
+
+func (o *configOptions) errorf(key, format string, args ...interface{}) {
+	o.errs.add(o.path+"."+key, format, args...)
+}
+
+// value returns the option with the key, marking it as used.
+func (o *configOptions) value(key string) (interface{}, bool) {
+	o.used[key] = true
+	v, ok := o.values[key]
+	return v, ok && v != nil
+}
+
+// checkUnused reports the options that weren't read, in order.
+func (o *configOptions) checkUnused() {
+	var unused []string
+	for key := range o.values {
+		if !o.used[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	for _, key := range unused {
+		o.errorf(key, "unknown option")
+	}
+}
+
+func (o *configOptions) string(key string, required bool) string {
+	v, ok := o.value(key)
+	if !ok {
+		if required {
+			o.errorf(key, "required")
+		}
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		o.errorf(key, "expected a string")
+	} else if s == "" && required {
+		o.errorf(key, "required")
+	}
+	return s
+}
+
+func (o *configOptions) int(key string) int {
+	v, ok := o.value(key)
+	if !ok {
+		return 0
+	}
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		if n == math.Trunc(n) {
+			return int(n)
+		}
+	}
+	o.errorf(key, "expected an integer")
+	return 0
+}
+
+func (o *configOptions) bool(key string) bool {
+	v, ok := o.value(key)
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		o.errorf(key, "expected a boolean")
+	}
+	return b
+}
+
+// duration reads a duration in the format of time.ParseDuration, like "1.5s".
+func (o *configOptions) duration(key string) time.Duration {
+	v, ok := o.value(key)
+	if !ok {
+		return 0
+	}
+	s, ok := v.(string)
+	if !ok {
+		o.errorf(key, `expected a duration like "1.5s"`)
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		o.errorf(key, `expected a duration like "1.5s"`)
+	}
+	return d
+}
+
+func (o *configOptions) strings(key string) []string {
+	v, ok := o.value(key)
+	if !ok {
+		return nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		o.errorf(key, "expected a list of strings")
+		return nil
+	}
+	strs := make([]string, len(list))
+	for i, item := range list {
+		if strs[i], ok = item.(string); !ok {
+			o.errorf(fmt.Sprintf("%s[%d]", key, i), "expected a string")
+		}
+	}
+	return strs
+}
+
+func (o *configOptions) stringMap(key string) map[string]string {
+	v, ok := o.value(key)
+	if !ok {
+		return nil
+	}
+	values, ok := v.(map[string]interface{})
+	if !ok {
+		o.errorf(key, "expected a map of strings")
+		return nil
+	}
+	m := make(map[string]string, len(values))
+	for k, item := range values {
+		s, ok := item.(string)
+		if !ok {
+			o.errorf(key+"."+k, "expected a string")
+		}
+		m[k] = s
+	}
+	return m
+}
+
+// choice returns the index of the option value in choices, zero if it's not set.
+func (o *configOptions) choice(key string, choices ...string) int {
+	s := o.string(key, false)
+	if s == "" {
+		return 0
+	}
+	for i, choice := range choices {
+		if s == choice {
+			return i
+		}
+	}
+	o.errorf(key, "expected one of %s", strings.Join(choices, ", "))
+	return 0
+}
+
+func (o *configOptions) level(key, name string) Level {
+	level, ok := logLevelMap[strings.ToLower(name)]
+	if !ok {
+		o.errorf(key, "unknown log level %q", name)
+	}
+	return level
+}
+
+// tls reads the "tls", "ca_file", "cert_file" and "key_file" options, returning a function
+// loading the TLS configuration, or returning nil if TLS isn't enabled.
+func (o *configOptions) tls() (config func() (*tls.Config, error), enabled bool) {
+	enabled = o.bool("tls")
+	caFile := o.string("ca_file", false)
+	certFile := o.string("cert_file", false)
+	keyFile := o.string("key_file", false)
+	if (certFile == "") != (keyFile == "") {
+		o.errorf("cert_file", "cert_file and key_file must be set together")
+	}
+	enabled = enabled || caFile != "" || certFile != ""
+	return func() (*tls.Config, error) {
+		if !enabled {
+			return nil, nil
+		}
+		return NewTLSConfig(caFile, certFile, keyFile)
+	}, enabled
+}
@@ -42,8 +42,29 @@ func (h *FileHandler) Handle(rec *Record) {
 	h.m.Unlock()
 }
 
+// Flush commits the written output to disk if the file is a regular one, implementing Flusher.
+func (h *FileHandler) Flush() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+	info, err := h.f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return h.f.Sync()
+}
+
+// Close closes the file. The standard output and error are only flushed, as they are
+// shared with the rest of the process and may still be written after the handler is closed.
 func (h *FileHandler) Close() error {
-	return h.Close()
+	if h.f == os.Stdout || h.f == os.Stderr {
+		return h.Flush()
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.f.Close()
 }
 
 type Color int
@@ -0,0 +1,286 @@
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParsePredicate parses a textual filter expression, so filters can be configured without
+// rebuilding. Expressions compare the fields of records with values, and are combined with
+// "and", "or", "not" and parentheses, "and" binding tighter than "or":
+//
+//	logger = payments.*               logger name matching a glob pattern, see LoggerNameMatches
+//	file = "vendor/*"                 caller file matching a glob pattern, see CallerFileMatches
+//	message ~ "timeout|refused"       message matching a regular expression
+//	level >= warning                  level at least as severe as warning, also <=, >, < and =
+//	baggage.tenant = acme             baggage value, see BaggageEquals
+//	has baggage.tenant                baggage key, see HasBaggage
+//
+// Values are bare words or double quoted Go strings, and the "!=" and "!~" operators negate
+// "=" and "~". For example:
+//
+//	not logger = "github.com/noisy/*" and (level >= error or baggage.tenant = acme)
+func ParsePredicate(expression string) (FilterPredicate, error) {
+	tokens, err := tokenizeFilterExpression(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %v", expression, err)
+	}
+	p := &filterParser{tokens: tokens}
+	predicate, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %v", expression, err)
+	}
+	return predicate, nil
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+	offset int
+}
+
+func (t filterToken) String() string {
+	return fmt.Sprintf("%q at offset %d", t.text, t.offset)
+}
+
+// isOperator returns whether the token is an operator or a parenthesis.
+func (t filterToken) isOperator() bool {
+	if t.quoted {
+		return false
+	}
+	for _, op := range filterOperators {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// filterOperators are the operators of filter expressions, longest first.
+var filterOperators = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<", "(", ")"}
+
+func tokenizeFilterExpression(expression string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+
+		if c == '"' {
+			end := i + 1
+			for ; end < len(expression) && expression[end] != '"'; end++ {
+				if expression[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text, err := strconv.Unquote(expression[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %v", i, err)
+			}
+			tokens = append(tokens, filterToken{text: text, quoted: true, offset: i})
+			i = end + 1
+			continue
+		}
+
+		operator := ""
+		for _, op := range filterOperators {
+			if strings.HasPrefix(expression[i:], op) {
+				operator = op
+				break
+			}
+		}
+		if operator != "" {
+			tokens = append(tokens, filterToken{text: operator, offset: i})
+			i += len(operator)
+			continue
+		}
+
+		end := i
+		for end < len(expression) && !unicode.IsSpace(rune(expression[end])) && !strings.ContainsRune(`"!=~<>()`, rune(expression[end])) {
+			end++
+		}
+		if end == i {
+			return nil, fmt.Errorf("unexpected %q at offset %d", expression[i], i)
+		}
+		tokens = append(tokens, filterToken{text: expression[i:end], offset: i})
+		i = end
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// keyword returns whether the next token is the unquoted word, consuming it if so.
+func (p *filterParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) next(what string) (filterToken, error) {
+	if p.pos == len(p.tokens) {
+		return filterToken{}, fmt.Errorf("missing %s at the end", what)
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *filterParser) parseOr() (FilterPredicate, error) {
+	predicates, err := p.parseSequence("or", p.parseAnd)
+	if err != nil || len(predicates) == 1 {
+		return firstPredicate(predicates), err
+	}
+	return FilterOr(predicates...), nil
+}
+
+func (p *filterParser) parseAnd() (FilterPredicate, error) {
+	predicates, err := p.parseSequence("and", p.parseUnary)
+	if err != nil || len(predicates) == 1 {
+		return firstPredicate(predicates), err
+	}
+	return FilterAnd(predicates...), nil
+}
+
+// parseSequence parses operands separated by the keyword.
+func (p *filterParser) parseSequence(keyword string, parseOperand func() (FilterPredicate, error)) ([]FilterPredicate, error) {
+	var predicates []FilterPredicate
+	for {
+		predicate, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+		if !p.keyword(keyword) {
+			return predicates, nil
+		}
+	}
+}
+
+func firstPredicate(predicates []FilterPredicate) FilterPredicate {
+	if len(predicates) == 0 {
+		return nil
+	}
+	return predicates[0]
+}
+
+func (p *filterParser) parseUnary() (FilterPredicate, error) {
+	if p.keyword("not") {
+		predicate, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return FilterNot(predicate), nil
+	}
+
+	if p.pos < len(p.tokens) && p.tokens[p.pos].isOperator() && p.tokens[p.pos].text == "(" {
+		p.pos++
+		predicate, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, err := p.next(`")"`)
+		if err != nil {
+			return nil, err
+		}
+		if !closing.isOperator() || closing.text != ")" {
+			return nil, fmt.Errorf(`expected ")" instead of %s`, closing)
+		}
+		return predicate, nil
+	}
+
+	if p.keyword("has") {
+		field, err := p.next("baggage key")
+		if err != nil {
+			return nil, err
+		}
+		key := strings.TrimPrefix(field.text, "baggage.")
+		if field.quoted || key == field.text || key == "" {
+			return nil, fmt.Errorf("expected baggage.<key> instead of %s", field)
+		}
+		return HasBaggage(key), nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (FilterPredicate, error) {
+	field, err := p.next("field")
+	if err != nil {
+		return nil, err
+	}
+	operator, err := p.next("operator")
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next("value")
+	if err != nil {
+		return nil, err
+	}
+	if field.quoted || field.isOperator() || !operator.isOperator() || operator.text == "(" || operator.text == ")" || value.isOperator() {
+		return nil, fmt.Errorf("expected <field> <operator> <value> at offset %d", field.offset)
+	}
+
+	negated := false
+	switch operator.text {
+	case "!=":
+		negated, operator.text = true, "="
+	case "!~":
+		negated, operator.text = true, "~"
+	}
+
+	predicate, err := comparisonPredicate(field.text, operator.text, value.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid comparison at offset %d: %v", field.offset, err)
+	}
+	if negated {
+		return FilterNot(predicate), nil
+	}
+	return predicate, nil
+}
+
+func comparisonPredicate(field, operator, value string) (FilterPredicate, error) {
+	switch {
+	case field == "logger" && operator == "=":
+		return LoggerNameMatches(value)
+	case field == "file" && operator == "=":
+		return CallerFileMatches(value)
+	case field == "message" && operator == "~":
+		return MessageMatches(value)
+	case field == "level":
+		level, ok := logLevelMap[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", value)
+		}
+		// Levels are ordered from CRITICAL to DEBUG, so more severe means lower.
+		switch operator {
+		case "=":
+			return LevelBetween(level, level), nil
+		case ">=":
+			return LevelBetween(level, CRITICAL), nil
+		case ">":
+			return LevelBetween(level-1, CRITICAL), nil
+		case "<=":
+			return LevelBetween(DEBUG, level), nil
+		case "<":
+			return LevelBetween(DEBUG, level+1), nil
+		}
+	case strings.HasPrefix(field, "baggage.") && len(field) > len("baggage.") && operator == "=":
+		return BaggageEquals(strings.TrimPrefix(field, "baggage."), value), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %q for %q", operator, field)
+}
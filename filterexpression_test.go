@@ -0,0 +1,74 @@
+package log
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePredicate(t *testing.T) {
+	rec := &Record{
+		LoggerName:    "payments.http",
+		Message:       "connection refused",
+		Level:         WARNING,
+		Filename:      "/src/vendor/client.go",
+		ShortFilename: "vendor/client.go",
+		Baggage:       map[string]interface{}{"tenant": "acme", "attempt": 2},
+	}
+
+	for expression, matches := range map[string]bool{
+		`logger = payments.*`:                  true,
+		`logger = "payments"`:                  false,
+		`logger != payments.*`:                 false,
+		`file = "vendor/*"`:                    true,
+		`message ~ "refused|timeout"`:          true,
+		`message !~ refused`:                   false,
+		`level = warning`:                      true,
+		`level >= WARNING`:                     true,
+		`level > warning`:                      false,
+		`level >= error`:                       false,
+		`level <= warning`:                     true,
+		`level < warning`:                      false,
+		`level < error`:                        true,
+		`baggage.tenant = acme`:                true,
+		`baggage.attempt = "2"`:                true,
+		`baggage.tenant != acme`:               false,
+		`has baggage.tenant`:                   true,
+		`has baggage.user`:                     false,
+		`not has baggage.user`:                 true,
+		`level >= error or has baggage.tenant`: true,
+		`level >= error or has baggage.user`:   false,
+		`has baggage.user and level >= error or logger = payments.*`:                                               true,
+		`has baggage.user and (level >= error or logger = payments.*)`:                                             false,
+		`not (logger = "github.com/noisy/*" or message ~ "^health") and (level >= error or baggage.tenant = acme)`: true,
+		`not not logger = payments.*`: true,
+	} {
+		predicate, err := ParsePredicate(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, matches, predicate(rec), expression)
+	}
+}
+
+func TestParsePredicateErrors(t *testing.T) {
+	for expression, msg := range map[string]string{
+		``:                               "missing field at the end",
+		`logger`:                         "missing operator at the end",
+		`logger =`:                       "missing value at the end",
+		`logger = [payments`:             `invalid comparison at offset 0: invalid logger name pattern "[payments": syntax error in pattern`,
+		`message ~ "("`:                  "invalid comparison at offset 0: invalid message pattern \"(\": error parsing regexp: missing closing ): `(`",
+		`level >= loud`:                  `invalid comparison at offset 0: unknown level "loud"`,
+		`message = hello`:                `invalid comparison at offset 0: unsupported operator "=" for "message"`,
+		`(level >= error`:                `missing ")" at the end`,
+		`level >= error)`:                `unexpected ")" at offset 14`,
+		`has tenant`:                     `expected baggage.<key> instead of "tenant" at offset 4`,
+		`logger = "payments`:             "unterminated string at offset 9",
+		`logger = payments and`:          "missing field at the end",
+		`level >= error level >= notice`: `unexpected "level" at offset 15`,
+		`= error x`:                      "expected <field> <operator> <value> at offset 0",
+	} {
+		_, err := ParsePredicate(expression)
+		assert.EqualError(t, err, "invalid filter expression "+strconv.Quote(expression)+": "+msg, expression)
+	}
+}
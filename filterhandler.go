@@ -0,0 +1,130 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// FilterPredicate reports whether a record matches a condition.
+type FilterPredicate func(rec *Record) bool
+
+// LoggerNameMatches returns a FilterPredicate matching records whose logger name matches the glob
+// pattern, with the syntax of path.Match, like "payments.*".
+func LoggerNameMatches(pattern string) (FilterPredicate, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid logger name pattern %q: %v", pattern, err)
+	}
+	return func(rec *Record) bool {
+		matched, _ := path.Match(pattern, rec.LoggerName)
+		return matched
+	}, nil
+}
+
+// MessageMatches returns a FilterPredicate matching records whose message matches the
+// regular expression, like logtest.MessageMatches.
+func MessageMatches(expr string) (FilterPredicate, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message pattern %q: %v", expr, err)
+	}
+	return func(rec *Record) bool {
+		return re.MatchString(rec.Message)
+	}, nil
+}
+
+// LevelBetween returns a FilterPredicate matching records with levels from leastSevere to mostSevere, both included.
+func LevelBetween(leastSevere, mostSevere Level) FilterPredicate {
+	return func(rec *Record) bool {
+		return rec.Level <= leastSevere && rec.Level >= mostSevere
+	}
+}
+
+// HasBaggage returns a FilterPredicate matching records whose baggage has the key.
+func HasBaggage(key string) FilterPredicate {
+	return func(rec *Record) bool {
+		_, ok := rec.Baggage[key]
+		return ok
+	}
+}
+
+// BaggageEquals returns a FilterPredicate matching records whose baggage has the key
+// with a value formatted with fmt.Sprint as value.
+func BaggageEquals(key, value string) FilterPredicate {
+	return func(rec *Record) bool {
+		v, ok := rec.Baggage[key]
+		return ok && fmt.Sprint(v) == value
+	}
+}
+
+// CallerFileMatches returns a FilterPredicate matching records whose file name, absolute or
+// with its parent directory only, matches the glob pattern, with the syntax of path.Match.
+func CallerFileMatches(pattern string) (FilterPredicate, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid file pattern %q: %v", pattern, err)
+	}
+	return func(rec *Record) bool {
+		if matched, _ := path.Match(pattern, rec.ShortFilename); matched {
+			return true
+		}
+		matched, _ := path.Match(pattern, rec.Filename)
+		return matched
+	}, nil
+}
+
+// FilterAnd returns a FilterPredicate matching records matched by all the predicates.
+func FilterAnd(predicates ...FilterPredicate) FilterPredicate {
+	return func(rec *Record) bool {
+		for _, p := range predicates {
+			if !p(rec) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterOr returns a FilterPredicate matching records matched by any of the predicates.
+func FilterOr(predicates ...FilterPredicate) FilterPredicate {
+	return func(rec *Record) bool {
+		for _, p := range predicates {
+			if p(rec) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterNot returns a FilterPredicate matching records not matched by p.
+func FilterNot(p FilterPredicate) FilterPredicate {
+	return func(rec *Record) bool {
+		return !p(rec)
+	}
+}
+
+// FilterHandler decorates a handler emitting only the records matched by a FilterPredicate.
+type FilterHandler struct {
+	Handler
+	predicate FilterPredicate
+}
+
+// NewFilterHandler returns a FilterHandler emitting the records matched by predicate.
+// Predicates can be built with the functions of this package or parsed with ParsePredicate.
+func NewFilterHandler(handler Handler, predicate FilterPredicate) *FilterHandler {
+	return &FilterHandler{Handler: handler, predicate: predicate}
+}
+
+func (h *FilterHandler) Handle(rec *Record) {
+	if h.predicate(rec) {
+		h.Handler.Handle(rec)
+	}
+}
+
+// Flush flushes the decorated handler if it implements Flusher.
+func (h *FilterHandler) Flush() error {
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
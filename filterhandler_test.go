@@ -0,0 +1,82 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredicates(t *testing.T) {
+	rec := &Record{
+		LoggerName:    "payments.http",
+		Message:       "connection refused",
+		Level:         WARNING,
+		Filename:      "/src/vendor/client.go",
+		ShortFilename: "vendor/client.go",
+		Baggage:       map[string]interface{}{"tenant": "acme", "attempt": 2},
+	}
+
+	loggerName, err := LoggerNameMatches("payments.*")
+	require.NoError(t, err)
+	otherLoggerName, err := LoggerNameMatches("http")
+	require.NoError(t, err)
+	shortFile, err := CallerFileMatches("vendor/*")
+	require.NoError(t, err)
+	file, err := CallerFileMatches("/src/*/client.go")
+	require.NoError(t, err)
+	otherFile, err := CallerFileMatches("*.go")
+	require.NoError(t, err)
+	message, err := MessageMatches("refused|timeout")
+	require.NoError(t, err)
+	otherMessage, err := MessageMatches("^refused")
+	require.NoError(t, err)
+
+	for name, test := range map[string]struct {
+		predicate FilterPredicate
+		matches   bool
+	}{
+		"logger name":            {loggerName, true},
+		"other logger name":      {otherLoggerName, false},
+		"short file":             {shortFile, true},
+		"file":                   {file, true},
+		"other file":             {otherFile, false},
+		"message":                {message, true},
+		"other message":          {otherMessage, false},
+		"level in range":         {LevelBetween(NOTICE, ERROR), true},
+		"level below range":      {LevelBetween(ERROR, CRITICAL), false},
+		"level above range":      {LevelBetween(DEBUG, INFO), false},
+		"has baggage":            {HasBaggage("tenant"), true},
+		"doesn't have baggage":   {HasBaggage("user"), false},
+		"baggage equals":         {BaggageEquals("attempt", "2"), true},
+		"baggage doesn't equal":  {BaggageEquals("tenant", "other"), false},
+		"and":                    {FilterAnd(loggerName, HasBaggage("tenant")), true},
+		"and with a mismatch":    {FilterAnd(loggerName, HasBaggage("user")), false},
+		"or":                     {FilterOr(otherLoggerName, HasBaggage("tenant")), true},
+		"or without matches":     {FilterOr(otherLoggerName, HasBaggage("user")), false},
+		"not":                    {FilterNot(otherLoggerName), true},
+		"and without predicates": {FilterAnd(), true},
+		"or without predicates":  {FilterOr(), false},
+	} {
+		assert.Equal(t, test.matches, test.predicate(rec), name)
+	}
+}
+
+func TestPatternPredicatesRejectInvalidPatterns(t *testing.T) {
+	_, err := LoggerNameMatches("[payments")
+	assert.Error(t, err)
+	_, err = CallerFileMatches("[vendor")
+	assert.Error(t, err)
+	_, err = MessageMatches("(")
+	assert.Error(t, err)
+}
+
+func TestFilterHandler(t *testing.T) {
+	var messages []string
+	h := NewFilterHandler(handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }), HasBaggage("tenant"))
+
+	h.Handle(&Record{Message: "filtered"})
+	h.Handle(&Record{Message: "emitted", Baggage: map[string]interface{}{"tenant": "acme"}})
+	assert.Equal(t, []string{"emitted"}, messages)
+	assert.NoError(t, h.Flush())
+}
@@ -0,0 +1,101 @@
+package log
+
+import "sync"
+
+// DefaultFlightRecorderSize is the number of records kept by a FlightRecorderHandler created with a size lower than 1.
+const DefaultFlightRecorderSize = 1000
+
+// FlightRecorderHandler decorates a handler keeping the records below its level in a ring
+// buffer instead of emitting them. When a record at or above the trigger level arrives,
+// the buffered records are emitted before it, so the debug history that preceded an error
+// is logged. Emitted records are removed from the buffer, so they are never emitted twice.
+//
+// The level of the decorated handler is set to DEBUG so it emits the buffered records, and
+// the level of loggers must be low enough to produce the records to keep.
+type FlightRecorderHandler struct {
+	Handler
+	trigger Level
+
+	// emit is held while emitting the history and the record that triggered it, so the
+	// histories of concurrent triggers aren't interleaved.
+	emit  sync.Mutex
+	m     sync.Mutex
+	level Level
+	ring  []*Record
+	start int
+	count int
+}
+
+// NewFlightRecorderHandler returns a FlightRecorderHandler keeping the last size records
+// below DefaultLevel, or DefaultFlightRecorderSize if size is lower than 1, emitted when a
+// record at or above trigger arrives.
+func NewFlightRecorderHandler(handler Handler, size int, trigger Level) *FlightRecorderHandler {
+	if size < 1 {
+		size = DefaultFlightRecorderSize
+	}
+	handler.SetLevel(DEBUG)
+	return &FlightRecorderHandler{
+		Handler: handler,
+		trigger: trigger,
+		level:   DefaultLevel,
+		ring:    make([]*Record, size),
+	}
+}
+
+// SetLevel sets the level of the records emitted without buffering them.
+func (h *FlightRecorderHandler) SetLevel(l Level) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.level = l
+}
+
+func (h *FlightRecorderHandler) Handle(rec *Record) {
+	h.m.Lock()
+	switch {
+	case rec.Level <= h.trigger:
+		history := h.drain()
+		h.m.Unlock()
+		h.emit.Lock()
+		defer h.emit.Unlock()
+		for _, buffered := range history {
+			h.Handler.Handle(buffered)
+		}
+	case rec.Level <= h.level || rec.Released:
+		h.m.Unlock()
+	default:
+		h.push(rec)
+		h.m.Unlock()
+		return
+	}
+	h.Handler.Handle(rec)
+}
+
+// Flush flushes the decorated handler if it implements Flusher, the buffered records are not emitted.
+func (h *FlightRecorderHandler) Flush() error {
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// push adds the record to the ring, overwriting the oldest one if it's full.
+func (h *FlightRecorderHandler) push(rec *Record) {
+	h.ring[(h.start+h.count)%len(h.ring)] = rec
+	if h.count < len(h.ring) {
+		h.count++
+	} else {
+		h.start = (h.start + 1) % len(h.ring)
+	}
+}
+
+// drain returns the buffered records, oldest first, and empties the ring.
+func (h *FlightRecorderHandler) drain() []*Record {
+	records := make([]*Record, h.count)
+	for i := range records {
+		j := (h.start + i) % len(h.ring)
+		records[i] = h.ring[j]
+		h.ring[j] = nil
+	}
+	h.start, h.count = 0, 0
+	return records
+}
@@ -0,0 +1,78 @@
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlightRecorderHandler(t *testing.T) {
+	var messages []string
+	h := NewFlightRecorderHandler(handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }), 3, ERROR)
+	h.SetLevel(INFO)
+
+	h.Handle(&Record{Level: DEBUG, Message: "dropped from the ring"})
+	h.Handle(&Record{Level: DEBUG, Message: "debug 1"})
+	h.Handle(&Record{Level: INFO, Message: "info"})
+	h.Handle(&Record{Level: DEBUG, Message: "debug 2"})
+	h.Handle(&Record{Level: DEBUG, Message: "debug 3"})
+	assert.Equal(t, []string{"info"}, messages)
+
+	h.Handle(&Record{Level: ERROR, Message: "error"})
+	assert.Equal(t, []string{"info", "debug 1", "debug 2", "debug 3", "error"}, messages)
+
+	messages = nil
+	h.Handle(&Record{Level: CRITICAL, Message: "critical"})
+	assert.Equal(t, []string{"critical"}, messages, "records are not emitted twice")
+
+	h.Handle(&Record{Level: DEBUG, Message: "debug 4"})
+	h.Handle(&Record{Level: CRITICAL, Message: "critical again"})
+	assert.Equal(t, []string{"critical", "debug 4", "critical again"}, messages)
+}
+
+func TestFlightRecorderHandlerSetsDecoratedLevel(t *testing.T) {
+	decorated := NewWriterHandler(nil)
+	decorated.SetLevel(WARNING)
+
+	NewFlightRecorderHandler(decorated, 10, ERROR)
+	assert.Equal(t, DEBUG, decorated.Level)
+}
+
+func TestFlightRecorderHandlerDefaultSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		h := NewFlightRecorderHandler(handlerFunc(func(*Record) {}), size, ERROR)
+		assert.Len(t, h.ring, DefaultFlightRecorderSize)
+	}
+}
+
+func TestFlightRecorderHandlerSerializesTriggers(t *testing.T) {
+	var emitting, emitted int32
+	var interleaved bool
+	h := NewFlightRecorderHandler(handlerFunc(func(rec *Record) {
+		if atomic.AddInt32(&emitting, 1) > 1 {
+			interleaved = true
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&emitting, -1)
+		atomic.AddInt32(&emitted, 1)
+	}), 10, ERROR)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				h.Handle(&Record{Level: DEBUG})
+				h.Handle(&Record{Level: ERROR})
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.False(t, interleaved, "histories of concurrent triggers must not be interleaved")
+	assert.Equal(t, int32(40), emitted)
+}
@@ -0,0 +1,219 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"time"
+)
+
+// FluentMode is the mode of the Fluentd Forward protocol used to send batches of records.
+type FluentMode int
+
+// Fluentd Forward protocol modes.
+const (
+	// ForwardMode sends each batch as an array of entries.
+	ForwardMode FluentMode = iota
+	// PackedForwardMode sends each batch as a binary string of concatenated entries.
+	PackedForwardMode
+)
+
+// Defaults of FluentConfig.
+const (
+	DefaultFluentBatchSize     = 100
+	DefaultFluentFlushInterval = time.Second
+	DefaultFluentAckTimeout    = 5 * time.Second
+	DefaultFluentMaxRetries    = 3
+	DefaultFluentRetryWait     = 100 * time.Millisecond
+)
+
+// FluentConfig configures a FluentHandler.
+type FluentConfig struct {
+	// Network is "tcp" or "unix", "tcp" by default.
+	Network string
+	// Address of the Fluentd or Fluent Bit forward input, like "localhost:24224".
+	Address string
+	// Tag of the records.
+	Tag string
+	// Mode of the Forward protocol, ForwardMode by default.
+	Mode FluentMode
+	// BatchSize is the maximum number of records of each batch, DefaultFluentBatchSize by default.
+	BatchSize int
+	// FlushInterval is the maximum time a record waits to be sent, DefaultFluentFlushInterval by default.
+	FlushInterval time.Duration
+	// RequireAck waits for the server to acknowledge each batch, sending it again
+	// if it isn't acknowledged, for at-least-once delivery.
+	RequireAck bool
+	// AckTimeout is the time to wait for acknowledgements, DefaultFluentAckTimeout by default.
+	AckTimeout time.Duration
+	// MaxRetries is the number of times a batch is sent again after failing, DefaultFluentMaxRetries
+	// by default, negative to never retry.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled on each retry, DefaultFluentRetryWait by default.
+	RetryWait time.Duration
+	// DialTimeout is the timeout of each dial, DefaultNetDialTimeout by default.
+	DialTimeout time.Duration
+	// WriteTimeout is the deadline of each write, DefaultNetWriteTimeout by default.
+	WriteTimeout time.Duration
+}
+
+// FluentHandler sends the logging output to Fluentd or Fluent Bit with the Forward protocol.
+// Records are sent in batches as [tag, time, record] entries with EventTime timestamps, where
+// the record has the fields of the log record and the baggage keys. The formatter is not used.
+// Connections are dialed again after errors, with exponential backoff, and batches that can't
+// be sent after MaxRetries are dropped, reporting the error with OnHandlerError.
+type FluentHandler struct {
+	*BaseHandler
+	cfg     FluentConfig
+	conn    *reconnectingConn
+	batcher *batcher
+}
+
+// NewFluentHandler returns a FluentHandler connected to the configured forward input.
+func NewFluentHandler(cfg FluentConfig) (*FluentHandler, error) {
+	if cfg.Network == "" {
+		cfg.Network = "tcp"
+	}
+	switch cfg.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	default:
+		return nil, fmt.Errorf("unsupported fluentd network %q", cfg.Network)
+	}
+	if cfg.Tag == "" {
+		return nil, fmt.Errorf("fluentd tag is required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultFluentBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFluentFlushInterval
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = DefaultFluentAckTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultFluentMaxRetries
+	}
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = DefaultFluentRetryWait
+	}
+
+	conn, err := dialReconnecting(connConfig{
+		Network:      cfg.Network,
+		Address:      cfg.Address,
+		DialTimeout:  cfg.DialTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h := &FluentHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		conn:        conn,
+	}
+	h.batcher = newBatcher(cfg.BatchSize, cfg.FlushInterval, h.send)
+	return h, nil
+}
+
+func (h *FluentHandler) Handle(rec *Record) {
+	if !h.BaseHandler.Filter(rec) {
+		return
+	}
+	h.batcher.add(rec)
+}
+
+// Flush sends the pending records.
+func (h *FluentHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the pending records and closes the connection.
+func (h *FluentHandler) Close() error {
+	h.batcher.close()
+	return h.conn.Close()
+}
+
+// send sends a batch, retrying with exponential backoff when it fails.
+func (h *FluentHandler) send(batch []*Record) {
+	chunk := ""
+	if h.cfg.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			OnHandlerError(fmt.Errorf("can't send %d records to fluentd: %v", len(batch), err))
+			return
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+	message := h.message(batch, chunk)
+
+	wait := h.cfg.RetryWait
+	for retry := 0; ; retry++ {
+		err := h.write(message, chunk)
+		if err == nil {
+			return
+		}
+		if retry >= h.cfg.MaxRetries {
+			OnHandlerError(fmt.Errorf("can't send %d records to fluentd: %v", len(batch), err))
+			return
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// message encodes the batch as a Forward or PackedForward mode message.
+func (h *FluentHandler) message(batch []*Record, chunk string) []byte {
+	entries := make([]interface{}, len(batch))
+	for i, rec := range batch {
+		entries[i] = []interface{}{msgpackEventTime(rec.Time), recordFields(rec)}
+	}
+
+	option := map[string]interface{}{"size": len(batch)}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+
+	enc := &msgpackEncoder{}
+	if h.cfg.Mode == PackedForwardMode {
+		packed := &msgpackEncoder{}
+		for _, entry := range entries {
+			packed.encode(entry)
+		}
+		enc.encode([]interface{}{h.cfg.Tag, packed.Bytes(), option})
+	} else {
+		enc.encode([]interface{}{h.cfg.Tag, entries, option})
+	}
+	return enc.Bytes()
+}
+
+// write writes the message, dialing the connection if needed, and waits for its
+// acknowledgement if chunk is not empty.
+func (h *FluentHandler) write(message []byte, chunk string) error {
+	return h.conn.use(func(conn net.Conn) error {
+		return h.writeMessage(conn, message, chunk)
+	})
+}
+
+func (h *FluentHandler) writeMessage(conn net.Conn, message []byte, chunk string) error {
+	if _, err := h.conn.write(conn, message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(h.cfg.AckTimeout)); err != nil {
+		return err
+	}
+	response, err := newMsgpackDecoder(conn).decode()
+	if err != nil {
+		return fmt.Errorf("can't read ack: %v", err)
+	}
+	if m, ok := response.(map[interface{}]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("unexpected ack response %v", response)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fluentMessage struct {
+	conn    int
+	tag     interface{}
+	entries []interface{}
+	option  map[interface{}]interface{}
+}
+
+func TestFluentHandlerForwardMode(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := serveFluent(t, listener, nil)
+
+	h, err := NewFluentHandler(FluentConfig{
+		Address:       listener.Addr().String(),
+		Tag:           "app.payments",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetLevel(INFO)
+
+	h.Handle(&Record{
+		Level:      INFO,
+		Time:       testRecordTime,
+		Message:    "first",
+		LoggerName: "payments",
+		Filename:   "/src/main.go",
+		Line:       42,
+		Baggage:    map[string]interface{}{"tenant": "acme", "message": "ignored"},
+	})
+	h.Handle(&Record{Level: DEBUG, Time: testRecordTime, Message: "filtered"})
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "second", Stack: Stack{{Function: "main.main", File: "/src/main.go", Line: 42}}})
+
+	message := <-messages
+	assert.Equal(t, "app.payments", message.tag)
+	assert.Equal(t, map[interface{}]interface{}{"size": int64(2)}, message.option)
+	require.Len(t, message.entries, 2)
+
+	first := message.entries[0].([]interface{})
+	assert.Equal(t, testEventTime(testRecordTime), first[0])
+	assert.Equal(t, map[interface{}]interface{}{
+		"message": "first",
+		"level":   "INFO",
+		"logger":  "payments",
+		"file":    "/src/main.go",
+		"line":    int64(42),
+		"process": "",
+		"pid":     int64(0),
+		"tenant":  "acme",
+	}, first[1])
+	second := message.entries[1].([]interface{})[1].(map[interface{}]interface{})
+	assert.Equal(t, "second", second["message"])
+	assert.Equal(t, []interface{}{
+		map[interface{}]interface{}{"function": "main.main", "file": "/src/main.go", "line": int64(42)},
+	}, second["stack"], "stacks are arrays of frames, like in JSONFormatter")
+}
+
+func TestFluentHandlerPackedForwardMode(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := serveFluent(t, listener, nil)
+
+	h, err := NewFluentHandler(FluentConfig{
+		Address:       listener.Addr().String(),
+		Tag:           "app",
+		Mode:          PackedForwardMode,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "first"})
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "second"})
+	require.NoError(t, h.Close())
+
+	message := <-messages
+	assert.Equal(t, "app", message.tag)
+	require.Len(t, message.entries, 2)
+	for i, expected := range []string{"first", "second"} {
+		entry := message.entries[i].([]interface{})
+		assert.Equal(t, testEventTime(testRecordTime), entry[0])
+		assert.Equal(t, expected, entry[1].(map[interface{}]interface{})["message"])
+	}
+}
+
+func TestFluentHandlerAckRetriesOnNewConnection(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	// The first connection is closed without acknowledging the message.
+	messages := serveFluent(t, listener, func(conn int) bool { return conn > 0 })
+
+	h, err := NewFluentHandler(FluentConfig{
+		Address:       listener.Addr().String(),
+		Tag:           "app",
+		FlushInterval: time.Hour,
+		RequireAck:    true,
+		RetryWait:     time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "delivered"})
+	require.NoError(t, h.Flush())
+
+	first, second := <-messages, <-messages
+	assert.Equal(t, 0, first.conn)
+	assert.Equal(t, 1, second.conn)
+	assert.NotEmpty(t, first.option["chunk"])
+	assert.Equal(t, first.option["chunk"], second.option["chunk"])
+	assert.Equal(t, first.entries, second.entries)
+	assert.Empty(t, errs)
+}
+
+func TestFluentHandlerDropsBatchAfterRetries(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := serveFluent(t, listener, func(int) bool { return false })
+
+	h, err := NewFluentHandler(FluentConfig{
+		Address:       listener.Addr().String(),
+		Tag:           "app",
+		FlushInterval: time.Hour,
+		RequireAck:    true,
+		MaxRetries:    1,
+		RetryWait:     time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "dropped"})
+	require.NoError(t, h.Flush())
+
+	assert.Len(t, messages, 2)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "can't send 1 records to fluentd")
+}
+
+// serveFluent accepts connections and sends the messages received to the returned channel.
+// When ack is not nil, messages are acknowledged if it returns true for the number of
+// the connection, otherwise the connection is closed.
+func serveFluent(t *testing.T, listener net.Listener, ack func(conn int) bool) <-chan fluentMessage {
+	messages := make(chan fluentMessage, 10)
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(i int, conn net.Conn) {
+				defer conn.Close()
+				dec := newMsgpackDecoder(conn)
+				for {
+					v, err := dec.decode()
+					if err != nil {
+						return
+					}
+					message := decodeFluentMessage(t, v)
+					message.conn = i
+					messages <- message
+
+					if ack == nil {
+						continue
+					}
+					if !ack(i) {
+						return
+					}
+					enc := &msgpackEncoder{}
+					enc.encode(map[string]interface{}{"ack": message.option["chunk"]})
+					if _, err := conn.Write(enc.Bytes()); err != nil {
+						return
+					}
+				}
+			}(i, conn)
+		}
+	}()
+	return messages
+}
+
+func decodeFluentMessage(t *testing.T, v interface{}) fluentMessage {
+	array, ok := v.([]interface{})
+	require.True(t, ok)
+	require.Len(t, array, 3)
+
+	message := fluentMessage{tag: array[0], option: array[2].(map[interface{}]interface{})}
+	switch entries := array[1].(type) {
+	case []interface{}:
+		message.entries = entries
+	case []byte:
+		dec := newMsgpackDecoder(bytes.NewReader(entries))
+		for {
+			entry, err := dec.decode()
+			if err != nil {
+				break
+			}
+			message.entries = append(message.entries, entry)
+		}
+	default:
+		t.Errorf("unexpected entries %#v", entries)
+	}
+	return message
+}
+
+func testEventTime(tm time.Time) msgpackExt {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(tm.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(tm.Nanosecond()))
+	return msgpackExt{Type: 0, Data: data}
+}
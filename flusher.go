@@ -0,0 +1,74 @@
+package log
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Flusher is implemented by handlers that buffer their output and can force it to be written
+// without closing the handler.
+type Flusher interface {
+	Flush() error
+}
+
+// ErrFlushTimeout is returned by Flush and FlushTimeout when the handlers are not flushed in time.
+var ErrFlushTimeout = errors.New("timed out flushing log handlers")
+
+// Flush flushes the handler of DefaultLogger, DefaultHandler and the registered handlers
+// that implement Flusher, like when shutting down gracefully or before taking a crash snapshot.
+// It returns ErrFlushTimeout if they don't finish within ShutdownTimeout.
+func Flush() error {
+	return FlushTimeout(ShutdownTimeout)
+}
+
+// FlushTimeout is like Flush, returning ErrFlushTimeout if the handlers don't finish before
+// the given timeout. Handlers still flushing then keep running in the background.
+func FlushTimeout(timeout time.Duration) error {
+	return withTimeout(timeout, ErrFlushTimeout, func() error {
+		return flushHandlers(registeredHandlers())
+	})
+}
+
+// LoggerHandler returns the handler of a logger created with NewLogger, looking through the
+// wrappers provided by this package like NoDebugLogger or the loggers returned by For.
+// It returns nil for other Logger implementations.
+func LoggerHandler(l Logger) Handler {
+	switch l := l.(type) {
+	case *logger:
+		return l.Handler
+	case NoDebugLogger:
+		return LoggerHandler(l.Logger)
+	case baggageLogger:
+		return LoggerHandler(l.Logger)
+	default:
+		return nil
+	}
+}
+
+// flushHandlers flushes concurrently the given handlers that implement Flusher.
+func flushHandlers(handlers []Handler) error {
+	var result error
+	var m sync.Mutex
+	wg := sync.WaitGroup{}
+	for _, handler := range handlers {
+		flusher, ok := handler.(Flusher)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(flusher Flusher) {
+			err := flusher.Flush()
+			m.Lock()
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+			m.Unlock()
+			wg.Done()
+		}(flusher)
+	}
+	wg.Wait()
+	return result
+}
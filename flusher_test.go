@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushFlushesDefaultLoggerHandler(t *testing.T) {
+	defer restoreShutdownState()()
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	l := NewLogger("test")
+	l.SetHandler(NewMultiHandler(NewWriterHandler(w), newCloseRecorder()))
+	DefaultLogger = NoDebugLogger{Logger: l}
+	DefaultHandler = newCloseRecorder()
+
+	Info("buffered")
+	assert.Empty(t, buf.String())
+
+	require.NoError(t, Flush())
+	assert.Contains(t, buf.String(), "buffered")
+}
+
+func TestFlushTimesOut(t *testing.T) {
+	defer restoreShutdownState()()
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	DefaultHandler = blockingFlushHandler{handlerFunc: func(*Record) {}, blocked: blocked}
+
+	assert.Equal(t, ErrFlushTimeout, FlushTimeout(10*time.Millisecond))
+}
+
+type blockingFlushHandler struct {
+	handlerFunc
+	blocked chan struct{}
+}
+
+func (h blockingFlushHandler) Flush() error {
+	<-h.blocked
+	return nil
+}
+
+func TestFileHandlerFlush(t *testing.T) {
+	t.Run("syncs regular files", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "filehandler")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		assert.NoError(t, NewFileHandler(f).Flush())
+	})
+
+	t.Run("ignores pipes", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		defer w.Close()
+
+		assert.NoError(t, NewFileHandler(w).Flush())
+	})
+}
+
+func TestLoggerHandler(t *testing.T) {
+	handler := newCloseRecorder()
+	l := NewLogger("test")
+	l.SetHandler(handler)
+
+	assert.Equal(t, handler, LoggerHandler(l))
+	assert.Equal(t, handler, LoggerHandler(NoDebugLogger{Logger: l}))
+	assert.Equal(t, handler, LoggerHandler(Factory{baseLogger: l}.For(WithBaggageValue(context.Background(), "k", "v"))))
+	assert.Nil(t, LoggerHandler(nil))
+}
@@ -1,6 +1,11 @@
 package log
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Formatter formats a record.
 type Formatter interface {
@@ -8,11 +13,71 @@ type Formatter interface {
 	Format(*Record) (message string)
 }
 
-type defaultFormatter struct{}
+// Time layouts for formatters, besides the ones of the time package like time.RFC3339.
+const (
+	// DefaultTimeLayout is the layout of DefaultFormatter, with millisecond precision.
+	DefaultTimeLayout = "2006-01-02 15:04:05.000"
+	// EpochMillis formats times as the number of milliseconds elapsed since the Unix epoch.
+	EpochMillis = "epochmillis"
+)
+
+// timeLayoutNames maps the names accepted in Config.TimeLayout to time layouts.
+var timeLayoutNames = map[string]string{
+	"default":     DefaultTimeLayout,
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"epochmillis": EpochMillis,
+}
+
+type defaultFormatter struct {
+	timeLayout string
+	utc        bool
+}
+
+// NewDefaultFormatter returns a formatter like DefaultFormatter with the given time layout,
+// which can be EpochMillis, formatting times in UTC instead of local time if utc is true.
+func NewDefaultFormatter(timeLayout string, utc bool) Formatter {
+	return defaultFormatter{timeLayout: timeLayout, utc: utc}
+}
 
 // Format outputs a message like "2014-02-28 18:15:57.123 [example] INFO     something happened"
+// followed by the indented error chain and stack of the record, if any.
 func (f defaultFormatter) Format(rec *Record) string {
-	return fmt.Sprintf("%s [%s] %-8s %s", fmt.Sprint(rec.Time)[:23], rec.LoggerName, LevelNames[rec.Level], rec.Message)
+	layout := f.timeLayout
+	if layout == "" {
+		layout = DefaultTimeLayout
+	}
+	message := fmt.Sprintf("%s [%s] %-8s %s", formatTime(rec.Time, layout, f.utc), rec.LoggerName, LevelNames[rec.Level], rec.Message)
+	if len(rec.Errors) == 0 && len(rec.Stack) == 0 {
+		return message
+	}
+
+	b := strings.Builder{}
+	b.WriteString(strings.TrimSuffix(message, "\n"))
+	for i, cause := range rec.Errors {
+		if i == 0 {
+			b.WriteString("\n\terror: ")
+		} else {
+			b.WriteString("\n\tcaused by: ")
+		}
+		b.WriteString(strings.Replace(cause.String(), "\n", "\n\t", -1))
+	}
+	if len(rec.Stack) > 0 {
+		b.WriteString("\n")
+		b.WriteString(rec.Stack.String())
+	}
+	return b.String()
+}
+
+// formatTime formats t with the given layout, which can be EpochMillis, in UTC if utc is true.
+func formatTime(t time.Time, layout string, utc bool) string {
+	if utc {
+		t = t.UTC()
+	}
+	if layout == EpochMillis {
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return t.Format(layout)
 }
 
 var LevelNames = map[Level]string{
@@ -17,3 +17,41 @@ func TestDefaultFormatterHasRightDateFormat(t *testing.T) {
 	line := DefaultFormatter.Format(&rec)
 	assert.Equal(t, "2018-06-11 12:35:18.123 [] INFO     Hello World!", line)
 }
+
+func TestDefaultFormatterTimeLayouts(t *testing.T) {
+	ts := time.Date(2018, 6, 11, 12, 35, 18, 123456000, time.FixedZone("CEST", 2*60*60))
+	rec := Record{
+		Level:   INFO,
+		Time:    ts,
+		Message: "Hello World!",
+	}
+
+	for _, tc := range []struct {
+		layout   string
+		utc      bool
+		expected string
+	}{
+		{layout: DefaultTimeLayout, expected: "2018-06-11 12:35:18.123"},
+		{layout: DefaultTimeLayout, utc: true, expected: "2018-06-11 10:35:18.123"},
+		{layout: "2006-01-02 15:04:05.000000", expected: "2018-06-11 12:35:18.123456"},
+		{layout: time.RFC3339, expected: "2018-06-11T12:35:18+02:00"},
+		{layout: time.RFC3339Nano, utc: true, expected: "2018-06-11T10:35:18.123456Z"},
+		{layout: EpochMillis, expected: "1528713318123"},
+	} {
+		t.Run(tc.layout, func(t *testing.T) {
+			line := NewDefaultFormatter(tc.layout, tc.utc).Format(&rec)
+			assert.Equal(t, tc.expected+" [] INFO     Hello World!", line)
+		})
+	}
+}
+
+func TestJSONFormatterTimeLayouts(t *testing.T) {
+	rec := Record{
+		Level: INFO,
+		Time:  time.Date(2018, 6, 11, 12, 35, 18, 123000000, time.FixedZone("CEST", 2*60*60)),
+	}
+
+	assert.Contains(t, JSONFormatter{}.Format(&rec), `"time":"2018-06-11T12:35:18.123+02:00"`)
+	assert.Contains(t, JSONFormatter{UTC: true}.Format(&rec), `"time":"2018-06-11T10:35:18.123Z"`)
+	assert.Contains(t, JSONFormatter{TimeLayout: EpochMillis}.Format(&rec), `"time":1528713318123`)
+}
@@ -0,0 +1,222 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GELFCompression is the compression of GELF messages sent over UDP.
+type GELFCompression int
+
+// GELF compressions.
+const (
+	GzipCompression GELFCompression = iota
+	ZlibCompression
+	NoCompression
+)
+
+const (
+	// DefaultGELFChunkSize is the maximum size of the UDP datagrams sent by GELFHandler.
+	DefaultGELFChunkSize = 1420
+	// gelfChunkHeaderSize is the size of the header of GELF chunks: magic bytes, message id, sequence number and count.
+	gelfChunkHeaderSize = 12
+	// gelfMaxChunks is the maximum number of chunks of a GELF message.
+	gelfMaxChunks = 128
+)
+
+// gelfFieldName matches valid names of GELF additional fields.
+var gelfFieldName = regexp.MustCompile(`^[\w\.\-]+$`)
+
+// GELFConfig configures a GELFHandler.
+type GELFConfig struct {
+	// Network is "udp" or "tcp".
+	Network string
+	// Address of the Graylog input, like "localhost:12201".
+	Address string
+	// Compression of the messages sent over UDP, gzip by default.
+	Compression GELFCompression
+	// ChunkSize is the maximum size of the UDP datagrams, DefaultGELFChunkSize by default.
+	ChunkSize int
+	// Host of the messages, os.Hostname() by default.
+	Host string
+	// DialTimeout is the timeout of each dial, DefaultNetDialTimeout by default.
+	DialTimeout time.Duration
+	// WriteTimeout is the deadline of each write, DefaultNetWriteTimeout by default.
+	WriteTimeout time.Duration
+}
+
+// GELFHandler sends the logging output to Graylog as GELF 1.1 messages, over UDP with
+// compression and chunking of large messages, or over TCP with null byte delimiters.
+// Records are sent with _file, _line and _logger additional fields, and a field for each baggage key.
+// Connections are dialed again after network errors, with exponential backoff, and records are
+// dropped while waiting to dial.
+type GELFHandler struct {
+	*BaseHandler
+	cfg  GELFConfig
+	udp  bool
+	conn *reconnectingConn
+}
+
+// NewGELFHandler returns a GELFHandler connected to the configured Graylog input.
+func NewGELFHandler(cfg GELFConfig) (*GELFHandler, error) {
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = DefaultGELFChunkSize
+	}
+	if cfg.ChunkSize <= gelfChunkHeaderSize {
+		return nil, fmt.Errorf("GELF chunk size %d is too small", cfg.ChunkSize)
+	}
+	if cfg.Host == "" {
+		cfg.Host, _ = os.Hostname()
+	}
+
+	var udp bool
+	switch cfg.Network {
+	case "udp", "udp4", "udp6":
+		udp = true
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported GELF network %q", cfg.Network)
+	}
+
+	conn, err := dialReconnecting(connConfig{
+		Network:      cfg.Network,
+		Address:      cfg.Address,
+		DialTimeout:  cfg.DialTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &GELFHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		udp:         udp,
+		conn:        conn,
+	}, nil
+}
+
+func (h *GELFHandler) Handle(rec *Record) {
+	message := h.BaseHandler.FilterAndFormat(rec)
+	if message == "" {
+		return
+	}
+
+	data, err := json.Marshal(h.payload(rec, message))
+	if err == nil {
+		if h.udp {
+			err = h.sendUDP(data)
+		} else {
+			_, err = h.conn.Write(append(data, 0))
+		}
+	}
+	if err != nil {
+		OnHandlerError(fmt.Errorf("can't send GELF message: %v", err))
+	}
+}
+
+// payload returns the GELF message of the record. The formatted message is sent as
+// full_message when the record message has more than one line or the record has a stack or errors.
+func (h *GELFHandler) payload(rec *Record, formatted string) map[string]interface{} {
+	message := strings.TrimSuffix(rec.Message, "\n")
+	short := message
+	if i := strings.Index(short, "\n"); i >= 0 {
+		short = short[:i]
+	}
+	if short == "" {
+		short = "-"
+	}
+
+	payload := map[string]interface{}{
+		"version":       "1.1",
+		"host":          h.cfg.Host,
+		"short_message": short,
+		"timestamp":     json.Number(strconv.FormatFloat(float64(rec.Time.UnixNano())/1e9, 'f', 6, 64)),
+		"level":         syslogSeverities[rec.Level],
+		"_file":         rec.Filename,
+		"_line":         rec.Line,
+		"_logger":       rec.LoggerName,
+	}
+	if short != message || len(rec.Stack) > 0 || len(rec.Errors) > 0 {
+		payload["full_message"] = strings.TrimSuffix(formatted, "\n")
+	}
+	for key, value := range rec.Baggage {
+		name := "_" + key
+		if _, exists := payload[name]; exists || name == "_id" || !gelfFieldName.MatchString(key) {
+			continue
+		}
+		payload[name] = fmt.Sprint(value)
+	}
+	return payload
+}
+
+// sendUDP compresses the message and sends it, in chunks if it doesn't fit in a single datagram.
+func (h *GELFHandler) sendUDP(data []byte) error {
+	data, err := h.compress(data)
+	if err != nil {
+		return err
+	}
+	if len(data) <= h.cfg.ChunkSize {
+		_, err = h.conn.Write(data)
+		return err
+	}
+
+	chunkDataSize := h.cfg.ChunkSize - gelfChunkHeaderSize
+	count := (len(data) + chunkDataSize - 1) / chunkDataSize
+	if count > gelfMaxChunks {
+		return fmt.Errorf("GELF message of %d bytes needs more than %d chunks", len(data), gelfMaxChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkDataSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*chunkDataSize)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[i*chunkDataSize:end]...)
+		if _, err := h.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *GELFHandler) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch h.cfg.Compression {
+	case GzipCompression:
+		w = gzip.NewWriter(&buf)
+	case ZlibCompression:
+		w = zlib.NewWriter(&buf)
+	default:
+		return data, nil
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *GELFHandler) Close() error {
+	return h.conn.Close()
+}
@@ -0,0 +1,156 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGELFHandlerUDP(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		compression GELFCompression
+		decompress  func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip", GzipCompression, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"zlib", ZlibCompression, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"no compression", NoCompression, func(r io.Reader) (io.Reader, error) { return r, nil }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+
+			h, err := NewGELFHandler(GELFConfig{
+				Network:     "udp",
+				Address:     listener.LocalAddr().String(),
+				Compression: tc.compression,
+				Host:        "host",
+			})
+			require.NoError(t, err)
+			defer h.Close()
+
+			h.Handle(&Record{
+				Level:      ERROR,
+				Time:       testRecordTime,
+				Message:    "something failed",
+				LoggerName: "payments",
+				Filename:   "/src/main.go",
+				Line:       42,
+				Baggage:    map[string]interface{}{"tenant": "acme", "id": "reserved", "invalid key": "ignored"},
+			})
+
+			buf := make([]byte, DefaultGELFChunkSize)
+			n, _, err := listener.ReadFrom(buf)
+			require.NoError(t, err)
+			r, err := tc.decompress(bytes.NewReader(buf[:n]))
+			require.NoError(t, err)
+
+			assert.Equal(t, map[string]interface{}{
+				"version":       "1.1",
+				"host":          "host",
+				"short_message": "something failed",
+				"timestamp":     1528720518.123456,
+				"level":         3.0,
+				"_file":         "/src/main.go",
+				"_line":         42.0,
+				"_logger":       "payments",
+				"_tenant":       "acme",
+			}, decodeGELF(t, r))
+		})
+	}
+}
+
+func TestGELFHandlerChunksLargeMessages(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h, err := NewGELFHandler(GELFConfig{
+		Network:     "udp",
+		Address:     listener.LocalAddr().String(),
+		Compression: NoCompression,
+		ChunkSize:   100,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	message := "first line\n" + strings.Repeat("a", 1000)
+	h.Handle(&Record{Level: INFO, Time: testRecordTime, Message: message})
+
+	var chunks [][]byte
+	for {
+		buf := make([]byte, 100)
+		n, _, err := listener.ReadFrom(buf)
+		require.NoError(t, err)
+		chunk := buf[:n]
+		require.Equal(t, []byte{0x1e, 0x0f}, chunk[:2])
+		if len(chunks) > 0 {
+			require.Equal(t, chunks[0][2:10], chunk[2:10], "message id")
+		}
+		require.Equal(t, byte(len(chunks)), chunk[10], "sequence number")
+		chunks = append(chunks, chunk)
+		if int(chunk[11]) == len(chunks) {
+			break
+		}
+	}
+
+	var data []byte
+	for _, chunk := range chunks {
+		data = append(data, chunk[12:]...)
+	}
+	payload := decodeGELF(t, bytes.NewReader(data))
+	assert.Equal(t, "first line", payload["short_message"])
+	assert.Equal(t, message, payload["full_message"])
+}
+
+func TestGELFHandlerTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			message, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			messages <- strings.TrimSuffix(message, "\x00")
+		}
+	}()
+
+	h, err := NewGELFHandler(GELFConfig{Network: "tcp", Address: listener.Addr().String()})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: WARNING, Time: testRecordTime, Message: "first"})
+	h.Handle(&Record{Level: WARNING, Time: testRecordTime, Message: "second"})
+
+	assert.Equal(t, "first", decodeGELF(t, strings.NewReader(<-messages))["short_message"])
+	assert.Equal(t, "second", decodeGELF(t, strings.NewReader(<-messages))["short_message"])
+}
+
+func decodeGELF(t *testing.T, r io.Reader) map[string]interface{} {
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &payload))
+	return payload
+}
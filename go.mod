@@ -1,8 +1,10 @@
 module github.com/cabify/go-logging
 
 require (
+	github.com/golang/snappy v0.0.1
 	github.com/hashicorp/go-multierror v1.0.0
 	github.com/mattn/go-isatty v0.0.4
 	github.com/stretchr/testify v1.3.0
-	golang.org/x/sys v0.0.0-20190219092855-153ac476189d // indirect
+	golang.org/x/sys v0.0.0-20190219092855-153ac476189d
+	gopkg.in/yaml.v2 v2.4.0
 )
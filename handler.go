@@ -1,5 +1,10 @@
 package log
 
+import (
+	"fmt"
+	"os"
+)
+
 // Handler handles the output.
 type Handler interface {
 	SetFormatter(Formatter)
@@ -9,3 +14,9 @@ type Handler interface {
 	// Close the handler.
 	Close() error
 }
+
+// OnHandlerError is called by handlers that fail to emit a record, like the ones
+// sending records over the network. By default it writes the error to stderr.
+var OnHandlerError = func(err error) {
+	fmt.Fprintf(os.Stderr, "logging: %v\n", err)
+}
@@ -0,0 +1,200 @@
+//go:build linux
+// +build linux
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultJournalSocket is the path of the socket of systemd-journald for the native protocol.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// journalFields are the fields set by JournalHandler, baggage keys can't override them.
+var journalFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"SYSLOG_IDENTIFIER": true,
+}
+
+// JournalHandler sends the logging output to systemd-journald using its native protocol.
+// Records are sent with PRIORITY, CODE_FILE, CODE_LINE, CODE_FUNC and SYSLOG_IDENTIFIER fields,
+// and each baggage key as an uppercase field.
+type JournalHandler struct {
+	*BaseHandler
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+}
+
+// NewJournalHandler returns a JournalHandler sending records to the local journal
+// with the given syslog identifier, the process name if empty.
+func NewJournalHandler(identifier string) (*JournalHandler, error) {
+	return NewJournalHandlerDial(DefaultJournalSocket, identifier)
+}
+
+// NewJournalHandlerDial returns a JournalHandler sending records to the journal listening
+// at the given socket path, with the given syslog identifier, the process name if empty.
+func NewJournalHandlerDial(socketPath, identifier string) (*JournalHandler, error) {
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	if identifier == "" {
+		identifier = procName
+	}
+	return &JournalHandler{
+		BaseHandler: NewBaseHandler(),
+		conn:        conn,
+		addr:        &net.UnixAddr{Name: socketPath, Net: "unixgram"},
+		identifier:  identifier,
+	}, nil
+}
+
+func (h *JournalHandler) Handle(rec *Record) {
+	message := h.BaseHandler.FilterAndFormat(rec)
+	if message == "" {
+		return
+	}
+
+	entry := &bytes.Buffer{}
+	writeJournalField(entry, "MESSAGE", strings.TrimSuffix(message, "\n"))
+	writeJournalField(entry, "PRIORITY", strconv.Itoa(syslogSeverities[rec.Level]))
+	writeJournalField(entry, "CODE_FILE", rec.Filename)
+	writeJournalField(entry, "CODE_LINE", strconv.Itoa(rec.Line))
+	if rec.Function != "" {
+		writeJournalField(entry, "CODE_FUNC", rec.Function)
+	}
+	writeJournalField(entry, "SYSLOG_IDENTIFIER", h.identifier)
+
+	keys := make([]string, 0, len(rec.Baggage))
+	for key := range rec.Baggage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if name := journalFieldName(key); name != "" && !journalFields[name] {
+			writeJournalField(entry, name, fmt.Sprint(rec.Baggage[key]))
+		}
+	}
+
+	if err := h.send(entry.Bytes()); err != nil {
+		OnHandlerError(fmt.Errorf("can't send journal entry: %v", err))
+	}
+}
+
+// send sends the entry in a datagram, or through a file descriptor if it's too large.
+func (h *JournalHandler) send(entry []byte) error {
+	_, _, err := h.conn.WriteMsgUnix(entry, nil, h.addr)
+	if err == nil {
+		return nil
+	}
+	if opErr, ok := err.(*net.OpError); !ok || !isMessageTooLarge(opErr.Err) {
+		return err
+	}
+
+	f, err := journalEntryFile(entry)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, _, err = h.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), h.addr)
+	return err
+}
+
+func (h *JournalHandler) Close() error {
+	return h.conn.Close()
+}
+
+func isMessageTooLarge(err error) bool {
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// journalEntryFile returns a sealed memfd containing the entry, falling back to
+// an unlinked temporary file when memfd is not supported.
+func journalEntryFile(entry []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("go-logging-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err == nil {
+		f := os.NewFile(uintptr(fd), "go-logging-journal")
+		if _, err := f.Write(entry); err != nil {
+			f.Close()
+			return nil, err
+		}
+		seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+		if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+
+	f, err := ioutil.TempFile("/dev/shm", "go-logging-journal")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Write(entry); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeJournalField serializes a field with the native protocol, values containing
+// line feeds are serialized with their length as a little endian 64 bit integer.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalFieldName returns the key as a valid journal field name: uppercase letters,
+// digits and underscores, starting with a letter and at most 64 characters long.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
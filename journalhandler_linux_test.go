@@ -0,0 +1,129 @@
+//go:build linux
+// +build linux
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalHandler(t *testing.T) {
+	socket := listenJournal(t)
+	h, err := NewJournalHandlerDial(socket.LocalAddr().String(), "my-service")
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{
+		Level:    WARNING,
+		Message:  "multi\nline",
+		Filename: "/src/main.go",
+		Line:     42,
+		Function: "main.main",
+		Baggage:  map[string]interface{}{"request-id": "abc", "message": "ignored", "42": "ignored"},
+	})
+
+	assert.Equal(t, map[string]string{
+		"MESSAGE":           "multi\nline",
+		"PRIORITY":          "4",
+		"CODE_FILE":         "/src/main.go",
+		"CODE_LINE":         "42",
+		"CODE_FUNC":         "main.main",
+		"SYSLOG_IDENTIFIER": "my-service",
+		"REQUEST_ID":        "abc",
+	}, readJournalEntry(t, socket))
+}
+
+func TestJournalHandlerSendsLargeEntriesThroughFiles(t *testing.T) {
+	socket := listenJournal(t)
+	h, err := NewJournalHandlerDial(socket.LocalAddr().String(), "")
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	message := strings.Repeat("a", 1<<20)
+	h.Handle(&Record{Level: INFO, Message: message})
+
+	entry := readJournalEntry(t, socket)
+	assert.Equal(t, message, entry["MESSAGE"])
+	assert.Equal(t, procName, entry["SYSLOG_IDENTIFIER"])
+}
+
+func TestNewJournalHandlerFailsWithoutJournal(t *testing.T) {
+	_, err := NewJournalHandlerDial(filepath.Join(t.TempDir(), "missing"), "")
+	assert.Error(t, err)
+}
+
+func TestJournalFieldName(t *testing.T) {
+	assert.Equal(t, "REQUEST_ID", journalFieldName("request.id"))
+	assert.Equal(t, "KEY", journalFieldName("_1key"))
+	assert.Equal(t, "", journalFieldName("_"))
+	assert.Len(t, journalFieldName(strings.Repeat("a", 100)), 64)
+}
+
+func listenJournal(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "socket")
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { socket.Close() })
+	return socket
+}
+
+// readJournalEntry reads an entry sent with the native protocol, either as a datagram or as a file.
+func readJournalEntry(t *testing.T, socket *net.UnixConn) map[string]string {
+	buf := make([]byte, 1<<16)
+	oob := make([]byte, 1024)
+	n, oobn, _, _, err := socket.ReadMsgUnix(buf, oob)
+	require.NoError(t, err)
+
+	data := buf[:n]
+	if oobn > 0 {
+		messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		fds, err := syscall.ParseUnixRights(&messages[0])
+		require.NoError(t, err)
+		require.Len(t, fds, 1)
+
+		f := os.NewFile(uintptr(fds[0]), "entry")
+		defer f.Close()
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		data, err = ioutil.ReadAll(f)
+		require.NoError(t, err)
+	}
+
+	entry := map[string]string{}
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return entry
+		}
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if i := strings.Index(line, "="); i >= 0 {
+			entry[line[:i]] = line[i+1:]
+			continue
+		}
+		var length uint64
+		require.NoError(t, binary.Read(r, binary.LittleEndian, &length))
+		value := make([]byte, length+1)
+		_, err = io.ReadFull(r, value)
+		require.NoError(t, err)
+		entry[line] = string(value[:length])
+	}
+}
@@ -0,0 +1,68 @@
+package log
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// JSONFormatter formats records as single line JSON objects, like
+// {"time":"2014-02-28T18:15:57.123+01:00","level":"INFO","logger":"example","message":"something happened"}
+type JSONFormatter struct {
+	// TimeLayout is the layout of the record times, time.RFC3339Nano by default.
+	// Times are formatted as numbers when it's EpochMillis.
+	TimeLayout string
+	// UTC formats times in UTC instead of local time.
+	UTC bool
+}
+
+type jsonRecord struct {
+	Time    interface{}            `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger"`
+	Message string                 `json:"message"`
+	File    string                 `json:"file,omitempty"`
+	Line    int                    `json:"line,omitempty"`
+	Process string                 `json:"process,omitempty"`
+	PID     int                    `json:"pid,omitempty"`
+	Stack   Stack                  `json:"stack,omitempty"`
+	Errors  []ErrorCause           `json:"errors,omitempty"`
+	Baggage map[string]interface{} `json:"baggage,omitempty"`
+}
+
+// Format outputs the record as a JSON object, the stack and the error chain of the record,
+// if any, are arrays.
+func (f JSONFormatter) Format(rec *Record) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(jsonRecord{
+		Time:    f.time(rec.Time),
+		Level:   LevelNames[rec.Level],
+		Logger:  rec.LoggerName,
+		Message: rec.Message,
+		File:    rec.Filename,
+		Line:    rec.Line,
+		Process: rec.ProcessName,
+		PID:     rec.ProcessID,
+		Stack:   rec.Stack,
+		Errors:  rec.Errors,
+		Baggage: rec.Baggage,
+	})
+	if err != nil {
+		return rec.Message
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (f JSONFormatter) time(t time.Time) interface{} {
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	formatted := formatTime(t, layout, f.UTC)
+	if layout == EpochMillis {
+		return json.Number(formatted)
+	}
+	return formatted
+}
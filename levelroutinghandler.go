@@ -0,0 +1,94 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// LevelRoute sends the records with levels from LeastSevere to MostSevere, both included,
+// to Handler. The zero value of MostSevere is CRITICAL, so for example
+// {LeastSevere: ERROR, Handler: h} routes ERROR and CRITICAL records.
+type LevelRoute struct {
+	LeastSevere Level
+	MostSevere  Level
+	Handler     Handler
+}
+
+func (r LevelRoute) matches(level Level) bool {
+	return level <= r.LeastSevere && level >= r.MostSevere
+}
+
+// LevelRoutingHandler sends each record to the handler of the first route whose level range
+// contains the level of the record, or to the default handler if none does.
+type LevelRoutingHandler struct {
+	routes         []LevelRoute
+	defaultHandler Handler
+}
+
+// NewLevelRoutingHandler returns a LevelRoutingHandler with the given routes. Records not
+// matching any route are sent to defaultHandler, and discarded if it's nil. Routes must
+// have a handler and a level range with at least one level.
+func NewLevelRoutingHandler(defaultHandler Handler, routes ...LevelRoute) (*LevelRoutingHandler, error) {
+	for i, route := range routes {
+		if route.Handler == nil {
+			return nil, fmt.Errorf("route %d has no handler", i)
+		}
+		if route.LeastSevere < route.MostSevere {
+			return nil, fmt.Errorf("route %d has %s as least severe level, which is more severe than %s", i, LevelNames[route.LeastSevere], LevelNames[route.MostSevere])
+		}
+	}
+	return &LevelRoutingHandler{routes: routes, defaultHandler: defaultHandler}, nil
+}
+
+// handlers returns the handlers of the routes and the default one, if any.
+func (h *LevelRoutingHandler) handlers() []Handler {
+	handlers := make([]Handler, 0, len(h.routes)+1)
+	for _, route := range h.routes {
+		handlers = append(handlers, route.Handler)
+	}
+	if h.defaultHandler != nil {
+		handlers = append(handlers, h.defaultHandler)
+	}
+	return handlers
+}
+
+func (h *LevelRoutingHandler) SetFormatter(f Formatter) {
+	for _, handler := range h.handlers() {
+		handler.SetFormatter(f)
+	}
+}
+
+func (h *LevelRoutingHandler) SetLevel(l Level) {
+	for _, handler := range h.handlers() {
+		handler.SetLevel(l)
+	}
+}
+
+func (h *LevelRoutingHandler) Handle(rec *Record) {
+	for _, route := range h.routes {
+		if route.matches(rec.Level) {
+			route.Handler.Handle(rec)
+			return
+		}
+	}
+	if h.defaultHandler != nil {
+		h.defaultHandler.Handle(rec)
+	}
+}
+
+// Flush flushes concurrently the handlers that implement Flusher.
+func (h *LevelRoutingHandler) Flush() error {
+	return flushHandlers(h.handlers())
+}
+
+// Close closes the handlers, FileHandlers of the standard outputs are only flushed.
+func (h *LevelRoutingHandler) Close() error {
+	var result error
+	for _, handler := range h.handlers() {
+		if err := handler.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelRoutingHandler(t *testing.T) {
+	var errorMessages, noticeMessages, otherMessages []string
+	h, err := NewLevelRoutingHandler(
+		handlerFunc(func(rec *Record) { t.Errorf("%q sent to the default handler", rec.Message) }),
+		LevelRoute{LeastSevere: ERROR, Handler: handlerFunc(func(rec *Record) { errorMessages = append(errorMessages, rec.Message) })},
+		LevelRoute{LeastSevere: NOTICE, MostSevere: WARNING, Handler: handlerFunc(func(rec *Record) { noticeMessages = append(noticeMessages, rec.Message) })},
+		LevelRoute{LeastSevere: DEBUG, MostSevere: CRITICAL, Handler: handlerFunc(func(rec *Record) { otherMessages = append(otherMessages, rec.Message) })},
+	)
+	require.NoError(t, err)
+
+	for level := CRITICAL; level <= DEBUG; level++ {
+		h.Handle(&Record{Level: level, Message: LevelNames[level]})
+	}
+	assert.Equal(t, []string{"CRITICAL", "ERROR"}, errorMessages)
+	assert.Equal(t, []string{"WARNING", "NOTICE"}, noticeMessages)
+	assert.Equal(t, []string{"INFO", "DEBUG"}, otherMessages, "the first matching route is used")
+}
+
+func TestLevelRoutingHandlerDefaultRoute(t *testing.T) {
+	var messages []string
+	h, err := NewLevelRoutingHandler(
+		handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }),
+		LevelRoute{LeastSevere: ERROR, Handler: handlerFunc(func(*Record) {})},
+	)
+	require.NoError(t, err)
+	h.Handle(&Record{Level: CRITICAL, Message: "routed"})
+	h.Handle(&Record{Level: DEBUG, Message: "default"})
+	assert.Equal(t, []string{"default"}, messages)
+
+	h, err = NewLevelRoutingHandler(nil)
+	require.NoError(t, err)
+	h.Handle(&Record{Level: INFO, Message: "discarded"})
+}
+
+func TestLevelRoutingHandlerValidatesRoutes(t *testing.T) {
+	_, err := NewLevelRoutingHandler(nil, LevelRoute{LeastSevere: ERROR})
+	assert.EqualError(t, err, "route 0 has no handler")
+
+	_, err = NewLevelRoutingHandler(nil, LevelRoute{LeastSevere: ERROR, MostSevere: DEBUG, Handler: handlerFunc(func(*Record) {})})
+	assert.EqualError(t, err, "route 0 has ERROR as least severe level, which is more severe than DEBUG")
+}
+
+func TestLevelRoutingHandlerClosesHandlers(t *testing.T) {
+	closed := 0
+	closer := closerFunc(func() error {
+		closed++
+		return errors.New("can't close")
+	})
+	h, err := NewLevelRoutingHandler(closer, LevelRoute{LeastSevere: ERROR, Handler: closer})
+	require.NoError(t, err)
+
+	assert.Error(t, h.Close())
+	assert.Equal(t, 2, closed)
+}
+
+func TestLevelRoutingHandlerCloseKeepsStandardOutputsOpen(t *testing.T) {
+	require.NoError(t, outputHandler(Config{Output: "stdout", ErrorOutput: "stderr"}).Close())
+
+	_, err := os.Stderr.Stat()
+	assert.NoError(t, err)
+	_, err = os.Stdout.Stat()
+	assert.NoError(t, err)
+}
+
+func TestOutputHandlerSplitsErrors(t *testing.T) {
+	h := outputHandler(Config{Output: "stdout", ErrorOutput: "stderr"})
+	routing, ok := h.(*LevelRoutingHandler)
+	if assert.True(t, ok) {
+		assert.Len(t, routing.routes, 1)
+		assert.Equal(t, LevelRoute{LeastSevere: ERROR, MostSevere: CRITICAL, Handler: routing.routes[0].Handler}, routing.routes[0])
+	}
+	assert.IsType(t, &FileHandler{}, outputHandler(Config{Output: "stdout"}))
+}
+
+type closerFunc func() error
+
+func (f closerFunc) SetFormatter(Formatter) {}
+func (f closerFunc) SetLevel(Level)         {}
+func (f closerFunc) Handle(*Record)         {}
+func (f closerFunc) Close() error           { return f() }
@@ -0,0 +1,185 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// LevelsEnvVar is the environment variable with the level spec of ConfigureDefaultLogger,
+// which overrides Config.Levels.
+const LevelsEnvVar = "LOG_LEVELS"
+
+// LevelSpec is a level for loggers, with overrides for the loggers whose names start with a prefix.
+type LevelSpec struct {
+	// Default is the level of loggers without overrides.
+	Default Level
+	// Overrides are the levels of loggers by prefix of their names. Prefixes match whole
+	// segments of names separated by "." or "/", so "payments" matches "payments" and
+	// "payments.http", but not "paymentsfoo". The longest matching prefix wins.
+	Overrides map[string]Level
+}
+
+// ParseLevelSpec parses a comma separated level spec like "info,payments=debug,http.client=warning",
+// with an optional default level, DefaultLevel if missing, and levels for logger name prefixes.
+// The Decode method of Level documents the accepted level names.
+func ParseLevelSpec(spec string) (LevelSpec, error) {
+	s := LevelSpec{Default: DefaultLevel, Overrides: map[string]Level{}}
+	hasDefault := false
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		prefix, levelName := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			prefix, levelName = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+			if prefix == "" {
+				return LevelSpec{}, fmt.Errorf("invalid level spec %q: missing logger name in %q", spec, entry)
+			}
+		}
+		level, ok := logLevelMap[strings.ToLower(levelName)]
+		if !ok {
+			return LevelSpec{}, fmt.Errorf("invalid level spec %q: unknown log level %q", spec, levelName)
+		}
+
+		if prefix == "" {
+			if hasDefault {
+				return LevelSpec{}, fmt.Errorf("invalid level spec %q: more than one default level", spec)
+			}
+			s.Default, hasDefault = level, true
+		} else {
+			s.Overrides[prefix] = level
+		}
+	}
+	return s, nil
+}
+
+// Level returns the level of loggers with the given name.
+func (s LevelSpec) Level(loggerName string) Level {
+	if level, ok := matchLevelOverride(s.Overrides, loggerName); ok {
+		return level
+	}
+	return s.Default
+}
+
+// matchLevelOverride returns the level of the longest prefix of loggerName in overrides, if any.
+func matchLevelOverride(overrides map[string]Level, loggerName string) (Level, bool) {
+	level, longest := Level(0), -1
+	for prefix, l := range overrides {
+		if hasNamePrefix(loggerName, prefix) && len(prefix) > longest {
+			level, longest = l, len(prefix)
+		}
+	}
+	return level, longest >= 0
+}
+
+// hasNamePrefix returns whether prefix is made of whole segments of the logger name.
+func hasNamePrefix(loggerName, prefix string) bool {
+	if !strings.HasPrefix(loggerName, prefix) {
+		return false
+	}
+	if len(loggerName) == len(prefix) || strings.HasSuffix(prefix, ".") || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	next := loggerName[len(prefix)]
+	return next == '.' || next == '/'
+}
+
+// String returns the spec in the format of ParseLevelSpec, with the overrides sorted.
+func (s LevelSpec) String() string {
+	entries := []string{logLevelNameMap[s.Default]}
+	prefixes := make([]string, 0, len(s.Overrides))
+	for prefix := range s.Overrides {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		entries = append(entries, prefix+"="+logLevelNameMap[s.Overrides[prefix]])
+	}
+	return strings.Join(entries, ",")
+}
+
+// verbosest returns the least severe level of the spec.
+func (s LevelSpec) verbosest() Level {
+	level := s.Default
+	for _, l := range s.Overrides {
+		if l > level {
+			level = l
+		}
+	}
+	return level
+}
+
+// levelOverrides holds the levelOverrideSpec set with SetLevelSpec.
+var levelOverrides atomic.Value
+
+// levelOverrideGeneration counts the specs set with SetLevelSpec, so loggers know when the
+// levels they cached are stale.
+var levelOverrideGeneration uint64
+
+type levelOverrideSpec struct {
+	generation uint64
+	overrides  map[string]Level
+}
+
+// SetLevelSpec sets the level of DefaultLogger and DefaultHandler to the default level of the
+// spec, like SetLevel, and makes the loggers of this package whose names match an override
+// log with its level instead of their own, even if it was set with their SetLevel method.
+// DefaultHandler is set to the least severe level of the spec, so it emits the records of
+// the overrides.
+func SetLevelSpec(spec LevelSpec) {
+	setLevelOverrides(spec.Overrides)
+	DefaultLevel = spec.Default
+	DefaultLogger.SetLevel(spec.Default)
+	DefaultHandler.SetLevel(spec.verbosest())
+}
+
+func setLevelOverrides(overrides map[string]Level) {
+	copied := make(map[string]Level, len(overrides))
+	for prefix, level := range overrides {
+		copied[prefix] = level
+	}
+	levelOverrides.Store(levelOverrideSpec{
+		generation: atomic.AddUint64(&levelOverrideGeneration, 1),
+		overrides:  copied,
+	})
+}
+
+// EffectiveLevels returns the current levels by logger name prefix: the overrides set with
+// SetLevelSpec, and DefaultLevel, the level of loggers without overrides, with the empty prefix.
+func EffectiveLevels() map[string]Level {
+	spec, _ := levelOverrides.Load().(levelOverrideSpec)
+	levels := make(map[string]Level, len(spec.overrides)+1)
+	for prefix, level := range spec.overrides {
+		levels[prefix] = level
+	}
+	levels[""] = DefaultLevel
+	return levels
+}
+
+// levelOverride caches the level set with SetLevelSpec for a logger, so the overrides are
+// only matched against its name when the spec changes.
+type levelOverride struct {
+	cached atomic.Value // cachedLevelOverride
+}
+
+type cachedLevelOverride struct {
+	generation uint64
+	level      Level
+	ok         bool
+}
+
+// level returns the level set with SetLevelSpec for loggers with the given name, if any.
+func (o *levelOverride) level(loggerName string) (Level, bool) {
+	spec, _ := levelOverrides.Load().(levelOverrideSpec)
+	cached, _ := o.cached.Load().(cachedLevelOverride)
+	if cached.generation != spec.generation {
+		cached.generation = spec.generation
+		cached.level, cached.ok = matchLevelOverride(spec.overrides, loggerName)
+		o.cached.Store(cached)
+	}
+	return cached.level, cached.ok
+}
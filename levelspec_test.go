@@ -0,0 +1,91 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevelSpec(t *testing.T) {
+	spec, err := ParseLevelSpec(" warning, payments=debug,http.client = ERROR,")
+	require.NoError(t, err)
+	assert.Equal(t, LevelSpec{
+		Default:   WARNING,
+		Overrides: map[string]Level{"payments": DEBUG, "http.client": ERROR},
+	}, spec)
+	assert.Equal(t, "warning,http.client=error,payments=debug", spec.String())
+
+	spec, err = ParseLevelSpec("payments=debug")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultLevel, spec.Default)
+}
+
+func TestParseLevelSpecErrors(t *testing.T) {
+	for spec, msg := range map[string]string{
+		"loud":           `invalid level spec "loud": unknown log level "loud"`,
+		"payments=loud":  `invalid level spec "payments=loud": unknown log level "loud"`,
+		"=debug":         `invalid level spec "=debug": missing logger name in "=debug"`,
+		"info,debug":     `invalid level spec "info,debug": more than one default level`,
+		"info,payments=": `invalid level spec "info,payments=": unknown log level ""`,
+	} {
+		_, err := ParseLevelSpec(spec)
+		assert.EqualError(t, err, msg, spec)
+	}
+}
+
+func TestLevelSpecMatchesLongestPrefix(t *testing.T) {
+	spec, err := ParseLevelSpec("info,http=warning,http.client=debug")
+	require.NoError(t, err)
+
+	assert.Equal(t, INFO, spec.Level("payments"))
+	assert.Equal(t, WARNING, spec.Level("http"))
+	assert.Equal(t, WARNING, spec.Level("http.server"))
+	assert.Equal(t, DEBUG, spec.Level("http.client"))
+	assert.Equal(t, DEBUG, spec.Level("http.client.retries"))
+	assert.Equal(t, DEBUG, spec.verbosest())
+}
+
+func TestLevelSpecMatchesWholeNameSegments(t *testing.T) {
+	spec, err := ParseLevelSpec("info,payments=debug,github.com/cabify/=warning")
+	require.NoError(t, err)
+
+	assert.Equal(t, DEBUG, spec.Level("payments"))
+	assert.Equal(t, DEBUG, spec.Level("payments.http"))
+	assert.Equal(t, DEBUG, spec.Level("payments/http"))
+	assert.Equal(t, INFO, spec.Level("paymentsfoo"))
+	assert.Equal(t, WARNING, spec.Level("github.com/cabify/go-logging"))
+}
+
+func TestSetLevelSpec(t *testing.T) {
+	defer func(level Level) {
+		setLevelOverrides(nil)
+		SetLevel(level)
+		DefaultLevel = level
+	}(DefaultLevel)
+
+	spec, err := ParseLevelSpec("warning,payments=debug")
+	require.NoError(t, err)
+	SetLevelSpec(spec)
+	assert.Equal(t, map[string]Level{"": WARNING, "payments": DEBUG}, EffectiveLevels())
+
+	var messages []string
+	handler := handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) })
+	payments := NewLogger("payments.http")
+	payments.SetHandler(handler)
+	other := NewLogger("shipping")
+	other.SetHandler(handler)
+
+	payments.Debug("payments debug")
+	other.Info("shipping info")
+	other.Warning("shipping warning")
+	assert.Equal(t, []string{"payments debug", "shipping warning"}, messages)
+
+	messages = nil
+	payments.SetLevel(ERROR)
+	payments.Debug("overrides win over SetLevel")
+	SetLevelSpec(LevelSpec{Default: WARNING})
+	payments.Debug("cached override discarded")
+	payments.Error("payments error")
+	assert.Equal(t, []string{"overrides win over SetLevel", "payments error"}, messages)
+}
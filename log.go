@@ -4,6 +4,7 @@ package log
 import (
 	"fmt"
 	"os"
+	"time"
 )
 
 type Level int
@@ -30,11 +31,25 @@ const (
 	DEBUG
 )
 
+// DefaultClock returns the time of the records of loggers without a clock set with SetClock.
+// It's called on each record, so replacing it affects existing loggers too.
+var DefaultClock = time.Now
+
+// ClockSetter is implemented by loggers whose clock can be replaced, like the ones created
+// with NewLogger. It's not part of Logger so existing implementations of Logger don't need
+// to implement it.
+type ClockSetter interface {
+	// SetClock sets the function used to get the time of the records.
+	// Default is calling logging.DefaultClock.
+	SetClock(func() time.Time)
+}
+
 var (
-	DefaultLogger    Logger    = NewLogger(procName)
-	DefaultLevel     Level     = INFO
-	DefaultHandler   Handler   = NewFileHandler(os.Stderr)
-	DefaultFormatter Formatter = defaultFormatter{}
+	DefaultLogger     Logger    = NewLogger(procName)
+	DefaultLevel      Level     = INFO
+	DefaultStackLevel Level     = NOSTACK
+	DefaultHandler    Handler   = NewFileHandler(os.Stderr)
+	DefaultFormatter  Formatter = defaultFormatter{}
 )
 
 ///////////////////
@@ -1,10 +1,10 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"time"
 )
 
@@ -18,13 +18,14 @@ type Logger interface {
 	// SetHandler replaces the current handler for output. Default is logging.StderrHandler.
 	SetHandler(Handler)
 
-	// SetCallDepth sets the parameter passed to runtime.Caller().
-	// It is used to get the file name from call stack.
-	// For example you need to set it to 1 if you are using a wrapper around
-	// the Logger. Default value is zero.
+	// SetCallDepth sets the number of frames skipped to get the file name
+	// from call stack, besides the ones of this package and the ones marked with
+	// logging.Helper(). For example you can set it to 1 if you are using a
+	// wrapper around the Logger instead of calling Helper. Default value is zero.
 	SetCallDepth(int)
 
-	// Fatal is equivalent to Logger.Critical followed by a call to os.Exit(1).
+	// Fatal is equivalent to Logger.Critical followed by a call to Exit(1),
+	// which closes the handlers before terminating the process.
 	Fatal(args ...interface{})
 	Fatalf(format string, args ...interface{})
 	Fatalln(args ...interface{})
@@ -62,89 +63,144 @@ type Logger interface {
 
 // logger is the default Logger implementation.
 type logger struct {
-	Name      string
-	Level     Level
-	Handler   Handler
-	calldepth int
+	Name       string
+	Level      Level
+	StackLevel Level
+	Handler    Handler
+	calldepth  int
+	err        error
+	clock      func() time.Time
+	override   *levelOverride // Shared with the copies made by WithError
 }
 
 // NewLogger returns a new Logger implementation. Do not forget to close it at exit.
 func NewLogger(name string) Logger {
 	return &logger{
-		Name:    name,
-		Level:   DefaultLevel,
-		Handler: DefaultHandler,
+		Name:       name,
+		Level:      DefaultLevel,
+		StackLevel: DefaultStackLevel,
+		Handler:    DefaultHandler,
+		override:   &levelOverride{},
 	}
 }
 
-func (l *logger) SetLevel(level Level) { l.Level = level }
-func (l *logger) SetHandler(b Handler) { l.Handler = b }
-func (l *logger) SetCallDepth(n int)   { l.calldepth = n }
+func (l *logger) SetLevel(level Level)        { l.Level = level }
+func (l *logger) SetHandler(b Handler)        { l.Handler = b }
+func (l *logger) SetCallDepth(n int)          { l.calldepth = n }
+func (l *logger) SetStackLevel(level Level)   { l.StackLevel = level }
+func (l *logger) SetClock(c func() time.Time) { l.clock = c }
+
+// WithError returns a copy of the logger that attaches err to its records.
+func (l *logger) WithError(err error) Logger {
+	child := *l
+	child.err = err
+	return &child
+}
 
 func (l *logger) log(level Level, args ...interface{}) {
-	if level > l.Level {
+	if !l.enabled(level, nil) {
 		return
 	}
-	l.logMsg(level, fmt.Sprint(args...))
+	l.emit(nil, nil, level, fmt.Sprint(args...))
 }
 
 func (l *logger) logf(level Level, format string, args ...interface{}) {
-	if level > l.Level {
+	if !l.enabled(level, nil) {
 		return
 	}
-	l.logMsg(level, fmt.Sprintf(format, args...))
+	l.emit(nil, nil, level, fmt.Sprintf(format, args...))
 }
 
 func (l *logger) logln(level Level, args ...interface{}) {
-	if level > l.Level {
+	if !l.enabled(level, nil) {
 		return
 	}
-	l.logMsg(level, fmt.Sprintln(args...))
+	l.emit(nil, nil, level, fmt.Sprintln(args...))
 }
 
-func (l *logger) logMsg(level Level, message string) {
-	if level > l.Level {
-		return
-	}
-
-	_, file, line, ok := runtime.Caller(l.calldepth + 2)
+// emit logs the message with the baggage of ctx, holding it in the request buffer if any.
+// Both are nil for records not logged through the loggers returned by For.
+func (l *logger) emit(ctx context.Context, buffer *requestBuffer, level Level, message string) {
+	frame, ok := caller(1, l.calldepth)
 	if !ok {
-		file = "???"
-		line = 0
+		frame.File = "???"
+		frame.Line = 0
 	}
 
 	rec := &Record{
-		Message:     message,
-		LoggerName:  l.Name,
-		Level:       level,
-		Time:        time.Now(),
-		Filename:    file,
-		Line:        line,
-		ProcessName: procName,
-		ProcessID:   pid,
+		Message:       message,
+		LoggerName:    l.Name,
+		Level:         level,
+		Time:          l.now(),
+		Filename:      frame.File,
+		ShortFilename: shortFilename(frame.File),
+		Line:          frame.Line,
+		Function:      frame.Function,
+		Package:       packageName(frame.Function),
+		ProcessName:   procName,
+		ProcessID:     pid,
+	}
+	if level <= l.StackLevel {
+		rec.Stack = captureStack(1, l.calldepth)
+	}
+	if l.err != nil {
+		rec.Errors = errorCauses(l.err)
+	}
+	if ctx != nil {
+		rec.Context = ctx
+		rec.Baggage, _ = ctx.Value(BaggageContextKey).(map[string]interface{})
 	}
 
+	if buffer != nil {
+		buffer.handle(l.Handler, rec, l.level())
+		return
+	}
 	l.Handler.Handle(rec)
 }
 
+// enabled returns whether the logger emits records of the level, or may hold them in the request buffer.
+func (l *logger) enabled(level Level, buffer *requestBuffer) bool {
+	return level <= l.level() || buffer.active()
+}
+
+// level returns the level of the logger, overridden by the level spec set with SetLevelSpec if it matches its name.
+func (l *logger) level() Level {
+	if level, ok := l.override.level(l.Name); ok {
+		return level
+	}
+	return l.Level
+}
+
+// now returns the current time from the clock of the logger, or from DefaultClock if none was set.
+func (l *logger) now() time.Time {
+	if l.clock != nil {
+		return l.clock()
+	}
+	return DefaultClock()
+}
+
 // procName returns the name of the current process.
 // func procName() string { return filepath.Base(os.Args[0]) }
 var procName = filepath.Base(os.Args[0])
 var pid = os.Getpid()
 
 func (l *logger) Fatal(args ...interface{}) {
-	l.log(CRITICAL, args...)
-	os.Exit(1)
+	l.fatal(nil, nil, fmt.Sprint(args...))
 }
 
 func (l *logger) Fatalf(format string, args ...interface{}) {
-	l.logf(CRITICAL, format, args...)
-	os.Exit(1)
+	l.fatal(nil, nil, fmt.Sprintf(format, args...))
 }
 
 func (l *logger) Fatalln(args ...interface{}) {
-	l.logln(CRITICAL, args...)
-	os.Exit(1)
+	l.fatal(nil, nil, fmt.Sprintln(args...))
+}
+
+// fatal emits the message as a CRITICAL record and calls Exit(1). It's the Fatal path of the
+// logger, shared with the loggers returned by For.
+func (l *logger) fatal(ctx context.Context, buffer *requestBuffer, message string) {
+	l.emit(ctx, buffer, CRITICAL, message)
+	Exit(1)
 }
 
 func (l *logger) Panic(args ...interface{}) {
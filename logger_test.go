@@ -0,0 +1,23 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockIsForwardedByNoDebugLogger(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var logger Logger = NoDebugLogger{Logger: l}
+	logger.(ClockSetter).SetClock(func() time.Time { return now })
+	logger.Error("error")
+
+	require.Len(t, records, 1)
+	assert.Equal(t, now, records[0].Time)
+}
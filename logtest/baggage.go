@@ -1,5 +1,6 @@
 /*
 Package logtest is intended to be used by tests for checking that baggage values have been correctly set
+and that the expected records have been logged
 */
 package logtest
 
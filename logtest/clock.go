@@ -0,0 +1,16 @@
+package logtest
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/cabify/go-logging"
+)
+
+// FreezeTime makes log.DefaultClock return the given time until the test finishes,
+// so the records of loggers without their own clock have a deterministic time.
+func FreezeTime(t testing.TB, frozen time.Time) {
+	previous := log.DefaultClock
+	log.DefaultClock = func() time.Time { return frozen }
+	t.Cleanup(func() { log.DefaultClock = previous })
+}
@@ -0,0 +1,29 @@
+package logtest_test
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/cabify/go-logging"
+	"github.com/cabify/go-logging/logtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeTime(t *testing.T) {
+	frozen := time.Date(2018, 6, 11, 12, 35, 18, 123000000, time.UTC)
+	recorder := logtest.NewRecorder()
+	logger := log.NewLogger("test")
+	logger.SetHandler(recorder)
+
+	t.Run("freezes time while the test runs", func(t *testing.T) {
+		logtest.FreezeTime(t, frozen)
+		logger.Info("frozen")
+	})
+	logger.Info("not frozen")
+
+	records := recorder.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t, frozen, records[0].Time)
+	assert.NotEqual(t, frozen, records[1].Time)
+}
@@ -0,0 +1,202 @@
+package logtest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/cabify/go-logging"
+)
+
+// Recorder is a log.Handler that keeps every record it handles, so tests can check what was logged.
+// It's safe for concurrent use.
+type Recorder struct {
+	m       sync.Mutex
+	level   log.Level
+	records []log.Record
+}
+
+// NewRecorder returns a Recorder that keeps records of all levels.
+func NewRecorder() *Recorder {
+	return &Recorder{level: log.DEBUG}
+}
+
+// InstallRecorder sets a new Recorder as the handler of log.DefaultLogger, restoring the
+// previous handler when the test finishes, or log.DefaultHandler if the previous one can't
+// be known because log.DefaultLogger isn't implemented by the log package.
+// It changes global state without synchronization, so it can't be used from parallel tests.
+func InstallRecorder(t testing.TB) *Recorder {
+	recorder := NewRecorder()
+	logger := log.DefaultLogger
+	previous := log.LoggerHandler(logger)
+	if previous == nil {
+		previous = log.DefaultHandler
+	}
+	logger.SetHandler(recorder)
+	t.Cleanup(func() { logger.SetHandler(previous) })
+	return recorder
+}
+
+// SetFormatter does nothing, records are kept unformatted.
+func (r *Recorder) SetFormatter(log.Formatter) {}
+
+// SetLevel sets the most verbose level of the records kept.
+func (r *Recorder) SetLevel(level log.Level) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.level = level
+}
+
+// Handle keeps a copy of the record.
+func (r *Recorder) Handle(rec *log.Record) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if rec.Level > r.level {
+		return
+	}
+	r.records = append(r.records, *rec)
+}
+
+// Close does nothing.
+func (r *Recorder) Close() error { return nil }
+
+// Records returns the records kept so far, in the order they were handled.
+func (r *Recorder) Records() []log.Record {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]log.Record(nil), r.records...)
+}
+
+// Reset discards the records kept so far.
+func (r *Recorder) Reset() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.records = nil
+}
+
+// Find returns the records that match all the given matchers.
+func (r *Recorder) Find(matchers ...Matcher) []log.Record {
+	var found []log.Record
+	for _, rec := range r.Records() {
+		if matchAll(rec, matchers) {
+			found = append(found, rec)
+		}
+	}
+	return found
+}
+
+// AssertLogged fails the test unless a record matching all the given matchers was logged.
+func (r *Recorder) AssertLogged(t testing.TB, matchers ...Matcher) bool {
+	t.Helper()
+	if len(r.Find(matchers...)) == 0 {
+		t.Errorf("No record matching %s was logged, records:\n%s", describe(matchers), r)
+		return false
+	}
+	return true
+}
+
+// AssertNotLogged fails the test if a record matching all the given matchers was logged.
+func (r *Recorder) AssertNotLogged(t testing.TB, matchers ...Matcher) bool {
+	t.Helper()
+	if found := r.Find(matchers...); len(found) > 0 {
+		t.Errorf("Unexpected record matching %s was logged: %s", describe(matchers), found[0].Message)
+		return false
+	}
+	return true
+}
+
+// String returns the messages of the records kept, one per line.
+func (r *Recorder) String() string {
+	var b strings.Builder
+	for _, rec := range r.Records() {
+		fmt.Fprintf(&b, "\t[%s] %s %s\n", rec.LoggerName, log.LevelNames[rec.Level], strings.TrimSuffix(rec.Message, "\n"))
+	}
+	return b.String()
+}
+
+// Matcher selects records of a Recorder.
+type Matcher struct {
+	description string
+	match       func(log.Record) bool
+}
+
+// String describes the matcher.
+func (m Matcher) String() string { return m.description }
+
+// ByLevel matches records of the given level.
+func ByLevel(level log.Level) Matcher {
+	return Matcher{
+		description: fmt.Sprintf("level %s", log.LevelNames[level]),
+		match:       func(rec log.Record) bool { return rec.Level == level },
+	}
+}
+
+// ByLoggerName matches records logged by the logger with the given name.
+func ByLoggerName(name string) Matcher {
+	return Matcher{
+		description: fmt.Sprintf("logger %q", name),
+		match:       func(rec log.Record) bool { return rec.LoggerName == name },
+	}
+}
+
+// MessageContains matches records whose message contains the given substring.
+func MessageContains(substr string) Matcher {
+	return Matcher{
+		description: fmt.Sprintf("message containing %q", substr),
+		match:       func(rec log.Record) bool { return strings.Contains(rec.Message, substr) },
+	}
+}
+
+// MessageMatches matches records whose message matches the given regular expression.
+// It panics if the expression can't be compiled.
+func MessageMatches(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return Matcher{
+		description: fmt.Sprintf("message matching /%s/", expr),
+		match:       func(rec log.Record) bool { return re.MatchString(rec.Message) },
+	}
+}
+
+// HasBaggageKey matches records whose baggage contains the given key.
+func HasBaggageKey(key string) Matcher {
+	return Matcher{
+		description: fmt.Sprintf("baggage key %q", key),
+		match: func(rec log.Record) bool {
+			_, ok := rec.Baggage[key]
+			return ok
+		},
+	}
+}
+
+// HasBaggageEntry matches records whose baggage contains the given key value pair.
+func HasBaggageEntry(key string, value interface{}) Matcher {
+	return Matcher{
+		description: fmt.Sprintf("baggage %s:%v", key, value),
+		match: func(rec log.Record) bool {
+			v, ok := rec.Baggage[key]
+			return ok && v == value
+		},
+	}
+}
+
+func matchAll(rec log.Record, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.match(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "anything"
+	}
+	descriptions := make([]string, len(matchers))
+	for i, m := range matchers {
+		descriptions[i] = m.description
+	}
+	return strings.Join(descriptions, " and ")
+}
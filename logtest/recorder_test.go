@@ -0,0 +1,81 @@
+package logtest_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	log "github.com/cabify/go-logging"
+	"github.com/cabify/go-logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallRecorder(t *testing.T) {
+	previous := log.LoggerHandler(log.DefaultLogger)
+
+	t.Run("records logs of DefaultLogger", func(t *testing.T) {
+		recorder := logtest.InstallRecorder(t)
+
+		ctx := log.WithBaggageValue(context.Background(), "tenant", "acme")
+		log.Warningf("disk at %d%%", 90)
+		log.For(ctx).Error("payment failed")
+
+		recorder.AssertLogged(t, logtest.ByLevel(log.WARNING), logtest.MessageMatches(`disk at \d+%`))
+		recorder.AssertLogged(t,
+			logtest.ByLevel(log.ERROR),
+			logtest.MessageContains("payment failed"),
+			logtest.HasBaggageKey("tenant"),
+			logtest.HasBaggageEntry("tenant", "acme"),
+		)
+		recorder.AssertNotLogged(t, logtest.ByLevel(log.CRITICAL))
+	})
+
+	assert.Equal(t, previous, log.LoggerHandler(log.DefaultLogger))
+}
+
+func TestInstallRecorderRestoresDefaultHandlerOfOtherLoggers(t *testing.T) {
+	l := otherLogger{Logger: log.NewLogger("test")}
+	previous := log.DefaultLogger
+	log.DefaultLogger = l
+	defer func() { log.DefaultLogger = previous }()
+
+	t.Run("installs the recorder", func(t *testing.T) {
+		logtest.InstallRecorder(t)
+		assert.NotEqual(t, log.DefaultHandler, log.LoggerHandler(l.Logger))
+	})
+
+	assert.Equal(t, log.DefaultHandler, log.LoggerHandler(l.Logger))
+}
+
+// otherLogger is a Logger not implemented by the log package.
+type otherLogger struct {
+	log.Logger
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := logtest.NewRecorder()
+	recorder.SetLevel(log.INFO)
+	logger := log.NewLogger("payments")
+	logger.SetLevel(log.DEBUG)
+	logger.SetHandler(recorder)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logger.Infof("message %d", i)
+			logger.Debugf("discarded %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, recorder.Records(), 10)
+	assert.Len(t, recorder.Find(logtest.ByLoggerName("payments"), logtest.ByLevel(log.INFO)), 10)
+	assert.Len(t, recorder.Find(logtest.MessageContains("message 3")), 1)
+	assert.Empty(t, recorder.Find(logtest.ByLevel(log.DEBUG)))
+	assert.Empty(t, recorder.Find(logtest.HasBaggageKey("tenant")))
+
+	recorder.Reset()
+	assert.Empty(t, recorder.Records())
+}
@@ -0,0 +1,58 @@
+package logtest
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/cabify/go-logging"
+)
+
+// testingHandler writes formatted records through testing.TB.Logf.
+type testingHandler struct {
+	*log.BaseHandler
+	t    testing.TB
+	m    sync.RWMutex
+	done bool
+}
+
+// TestingHandler returns a log.Handler that writes records of all levels through t.Logf,
+// so the output is attributed to the test and only shown when it fails or in verbose mode.
+// Since t.Logf reports the location of the logging package, messages are prefixed with
+// the file and line of their log call. Records handled once the test has finished are discarded.
+func TestingHandler(t testing.TB) log.Handler {
+	h := &testingHandler{
+		BaseHandler: log.NewBaseHandler(),
+		t:           t,
+	}
+	h.SetLevel(log.DEBUG)
+	t.Cleanup(func() {
+		h.m.Lock()
+		defer h.m.Unlock()
+		h.done = true
+	})
+	return h
+}
+
+func (h *testingHandler) Handle(rec *log.Record) {
+	message := h.BaseHandler.FilterAndFormat(rec)
+	if message == "" {
+		return
+	}
+
+	h.m.RLock()
+	defer h.m.RUnlock()
+	if h.done {
+		return
+	}
+	h.t.Helper()
+	message = strings.TrimSuffix(message, "\n")
+	if rec.Filename != "" {
+		h.t.Logf("%s:%d: %s", filepath.Base(rec.Filename), rec.Line, message)
+		return
+	}
+	h.t.Logf("%s", message)
+}
+
+func (h *testingHandler) Close() error { return nil }
@@ -0,0 +1,72 @@
+package logtest_test
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	log "github.com/cabify/go-logging"
+	"github.com/cabify/go-logging/logtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	testing.TB
+	logs     []string
+	cleanups []func()
+}
+
+func (t *fakeT) Logf(format string, args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Cleanup(fn func()) {
+	t.cleanups = append(t.cleanups, fn)
+}
+
+func (t *fakeT) finish() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+func TestTestingHandler(t *testing.T) {
+	ft := &fakeT{}
+	handler := logtest.TestingHandler(ft)
+	handler.SetFormatter(messageFormatter{})
+	logger := log.NewLogger("test")
+	logger.SetLevel(log.DEBUG)
+	logger.SetHandler(handler)
+
+	logger.Debug("debug")
+	line := nextLine()
+	logger.Infoln("with newline")
+	ft.finish()
+	logger.Info("after the test finished")
+
+	assert.Equal(t, []string{
+		fmt.Sprintf("testing_test.go:%d: debug", line-2),
+		fmt.Sprintf("testing_test.go:%d: with newline", line),
+	}, ft.logs)
+}
+
+func TestTestingHandlerWithRealTest(t *testing.T) {
+	logger := log.NewLogger("test")
+	t.Run("subtest", func(t *testing.T) {
+		logger.SetHandler(logtest.TestingHandler(t))
+		logger.Info("logged in subtest")
+	})
+	assert.NotPanics(t, func() { logger.Info("logged after subtest finished") })
+}
+
+// nextLine returns the line following the call.
+func nextLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line + 1
+}
+
+type messageFormatter struct{}
+
+func (messageFormatter) Format(rec *log.Record) string { return rec.Message }
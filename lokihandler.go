@@ -0,0 +1,308 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// LokiEncoding is the encoding of the requests sent to the Loki push API.
+type LokiEncoding int
+
+// Loki push API encodings.
+const (
+	// LokiJSON sends the streams as JSON.
+	LokiJSON LokiEncoding = iota
+	// LokiProtobuf sends the streams as snappy compressed protocol buffers.
+	LokiProtobuf
+)
+
+// Defaults of LokiConfig.
+const (
+	DefaultLokiBatchSize  = 1000
+	DefaultLokiBatchWait  = time.Second
+	DefaultLokiMaxRetries = 5
+	DefaultLokiMinBackoff = 500 * time.Millisecond
+	DefaultLokiMaxBackoff = 30 * time.Second
+	DefaultLokiTimeout    = 10 * time.Second
+)
+
+// LokiConfig configures a LokiHandler.
+type LokiConfig struct {
+	// URL of the push API, like "http://localhost:3100/loki/api/v1/push".
+	URL string
+	// TenantID is sent as the X-Scope-OrgID header if not empty.
+	TenantID string
+	// Labels are added to every stream.
+	Labels map[string]string
+	// BaggageLabels are the baggage keys promoted to stream labels.
+	BaggageLabels []string
+	// Encoding of the requests, LokiJSON by default.
+	Encoding LokiEncoding
+	// BatchSize is the maximum number of records of each request, DefaultLokiBatchSize by default.
+	BatchSize int
+	// BatchWait is the maximum time a record waits to be sent, DefaultLokiBatchWait by default.
+	BatchWait time.Duration
+	// MaxRetries is the number of times a request is sent again after failing, DefaultLokiMaxRetries
+	// by default, negative to never retry.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry, doubled on each retry, DefaultLokiMinBackoff by default.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum wait between retries, DefaultLokiMaxBackoff by default.
+	MaxBackoff time.Duration
+	// Client sends the requests, a client with a DefaultLokiTimeout timeout by default.
+	Client *http.Client
+}
+
+// LokiHandler pushes the logging output to Grafana Loki. Records are sent in batches grouped
+// in streams by their labels: process, logger, level, the configured labels and the promoted
+// baggage keys. The formatted records are the lines of the streams. Requests failing with
+// network errors, 429 or 5xx responses are retried, and batches that can't be sent are
+// dropped, reporting the error with OnHandlerError.
+type LokiHandler struct {
+	*BaseHandler
+	cfg     LokiConfig
+	batcher *batcher
+}
+
+// NewLokiHandler returns a LokiHandler pushing to the configured URL.
+func NewLokiHandler(cfg LokiConfig) (*LokiHandler, error) {
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid Loki URL: %v", err)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultLokiBatchSize
+	}
+	if cfg.BatchWait <= 0 {
+		cfg.BatchWait = DefaultLokiBatchWait
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultLokiMaxRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultLokiMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultLokiMaxBackoff
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultLokiTimeout}
+	}
+
+	h := &LokiHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+	}
+	h.batcher = newBatcher(cfg.BatchSize, cfg.BatchWait, h.send)
+	return h, nil
+}
+
+func (h *LokiHandler) Handle(rec *Record) {
+	if !h.BaseHandler.Filter(rec) {
+		return
+	}
+	h.batcher.add(rec)
+}
+
+// Flush sends the pending records.
+func (h *LokiHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the pending records.
+func (h *LokiHandler) Close() error {
+	h.batcher.close()
+	return nil
+}
+
+// lokiStream is a stream of a push request.
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+type lokiEntry struct {
+	time time.Time
+	line string
+}
+
+// send pushes a batch, retrying with exponential backoff when it fails.
+func (h *LokiHandler) send(batch []*Record) {
+	body, contentType := h.encode(h.streams(batch))
+
+	backoff := h.cfg.MinBackoff
+	for retry := 0; ; retry++ {
+		retryable, err := h.push(body, contentType)
+		if err == nil {
+			return
+		}
+		if !retryable || retry >= h.cfg.MaxRetries {
+			OnHandlerError(fmt.Errorf("can't push %d records to Loki: %v", len(batch), err))
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > h.cfg.MaxBackoff {
+			backoff = h.cfg.MaxBackoff
+		}
+	}
+}
+
+// streams groups the records of the batch by their labels, in order of appearance.
+func (h *LokiHandler) streams(batch []*Record) []*lokiStream {
+	var streams []*lokiStream
+	byLabels := map[string]*lokiStream{}
+	for _, rec := range batch {
+		labels := h.labels(rec)
+		key := lokiLabelsString(labels)
+		stream, ok := byLabels[key]
+		if !ok {
+			stream = &lokiStream{labels: labels}
+			byLabels[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.entries = append(stream.entries, lokiEntry{
+			time: rec.Time,
+			line: strings.TrimSuffix(h.Formatter.Format(rec), "\n"),
+		})
+	}
+	return streams
+}
+
+// labels returns the labels of the record stream, empty values are omitted.
+func (h *LokiHandler) labels(rec *Record) map[string]string {
+	labels := map[string]string{}
+	for name, value := range h.cfg.Labels {
+		labels[lokiLabelName(name)] = value
+	}
+	for _, key := range h.cfg.BaggageLabels {
+		if value, ok := rec.Baggage[key]; ok {
+			labels[lokiLabelName(key)] = fmt.Sprint(value)
+		}
+	}
+	labels["process"] = rec.ProcessName
+	labels["logger"] = rec.LoggerName
+	labels["level"] = strings.ToLower(LevelNames[rec.Level])
+	for name, value := range labels {
+		if value == "" {
+			delete(labels, name)
+		}
+	}
+	return labels
+}
+
+// encode returns the body of the push request and its content type.
+func (h *LokiHandler) encode(streams []*lokiStream) ([]byte, string) {
+	if h.cfg.Encoding == LokiProtobuf {
+		return snappy.Encode(nil, lokiProtobuf(streams)), "application/x-protobuf"
+	}
+
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	request := struct {
+		Streams []jsonStream `json:"streams"`
+	}{}
+	for _, stream := range streams {
+		values := make([][2]string, len(stream.entries))
+		for i, entry := range stream.entries {
+			values[i] = [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line}
+		}
+		request.Streams = append(request.Streams, jsonStream{Stream: stream.labels, Values: values})
+	}
+	body, _ := json.Marshal(request)
+	return body, "application/json"
+}
+
+// push sends a push request, and returns whether it can be retried when it fails.
+func (h *LokiHandler) push(body []byte, contentType string) (retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, h.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", h.cfg.TenantID)
+	}
+
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// lokiProtobuf encodes the streams as a logproto.PushRequest message.
+func lokiProtobuf(streams []*lokiStream) []byte {
+	req := &protoEncoder{}
+	for _, stream := range streams {
+		req.messageField(1, func(s *protoEncoder) {
+			s.stringField(1, lokiLabelsString(stream.labels))
+			for _, entry := range stream.entries {
+				s.messageField(2, func(e *protoEncoder) {
+					e.messageField(1, func(ts *protoEncoder) {
+						ts.intField(1, entry.time.Unix())
+						ts.intField(2, int64(entry.time.Nanosecond()))
+					})
+					e.stringField(2, entry.line)
+				})
+			}
+		})
+	}
+	return req.Bytes()
+}
+
+// lokiLabelsString returns the labels as a sorted label selector, like {level="info", logger="payments"}.
+func lokiLabelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := strings.Builder{}
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// lokiLabelName returns the name as a valid label name, replacing invalid characters with underscores.
+func lokiLabelName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
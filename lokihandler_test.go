@@ -0,0 +1,149 @@
+package log
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiHandlerJSON(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	h, err := NewLokiHandler(LokiConfig{
+		URL:           server.URL + "/loki/api/v1/push",
+		TenantID:      "team-a",
+		Labels:        map[string]string{"env": "test"},
+		BaggageLabels: []string{"tenant.id"},
+		BatchWait:     time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	baggage := map[string]interface{}{"tenant.id": "acme", "other": "ignored"}
+	h.Handle(&Record{Level: INFO, Time: testRecordTime, Message: "first", LoggerName: "payments", ProcessName: "app", Baggage: baggage})
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "second", LoggerName: "payments", ProcessName: "app"})
+	h.Handle(&Record{Level: INFO, Time: testRecordTime.Add(time.Millisecond), Message: "third", LoggerName: "payments", ProcessName: "app", Baggage: baggage})
+	require.NoError(t, h.Flush())
+
+	require.NotNil(t, req)
+	assert.Equal(t, "/loki/api/v1/push", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "team-a", req.Header.Get("X-Scope-OrgID"))
+	assert.JSONEq(t, `{"streams": [
+		{
+			"stream": {"env": "test", "level": "info", "logger": "payments", "process": "app", "tenant_id": "acme"},
+			"values": [["1528720518123456000", "first"], ["1528720518124456000", "third"]]
+		},
+		{
+			"stream": {"env": "test", "level": "error", "logger": "payments", "process": "app"},
+			"values": [["1528720518123456000", "second"]]
+		}
+	]}`, string(body))
+}
+
+func TestLokiHandlerProtobuf(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	h, err := NewLokiHandler(LokiConfig{URL: server.URL, Encoding: LokiProtobuf, BatchWait: time.Hour})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: WARNING, Time: testRecordTime, Message: "something", LoggerName: "payments"})
+	require.NoError(t, h.Flush())
+
+	assert.Equal(t, "application/x-protobuf", contentType)
+	data, err := snappy.Decode(nil, body)
+	require.NoError(t, err)
+
+	streams := decodeProto(t, data)[1]
+	require.Len(t, streams, 1)
+	stream := decodeProto(t, streams[0].([]byte))
+	assert.Equal(t, []interface{}{[]byte(`{level="warning", logger="payments"}`)}, stream[1])
+	require.Len(t, stream[2], 1)
+	entry := decodeProto(t, stream[2][0].([]byte))
+	assert.Equal(t, []interface{}{[]byte("something")}, entry[2])
+	timestamp := decodeProto(t, entry[1][0].([]byte))
+	assert.Equal(t, []interface{}{uint64(testRecordTime.Unix())}, timestamp[1])
+	assert.Equal(t, []interface{}{uint64(testRecordTime.Nanosecond())}, timestamp[2])
+}
+
+func TestLokiHandlerRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		requests int
+		failed   bool
+	}{
+		{"retries server errors", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNoContent}, 3, false},
+		{"gives up after max retries", []int{500, 500, 500}, 3, true},
+		{"doesn't retry client errors", []int{http.StatusBadRequest}, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []error
+			onHandlerError := OnHandlerError
+			OnHandlerError = func(err error) { errs = append(errs, err) }
+			defer func() { OnHandlerError = onHandlerError }()
+
+			var m sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m.Lock()
+				defer m.Unlock()
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			h, err := NewLokiHandler(LokiConfig{
+				URL:        server.URL,
+				BatchWait:  time.Hour,
+				MaxRetries: 2,
+				MinBackoff: time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer h.Close()
+
+			h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "something"})
+			require.NoError(t, h.Flush())
+
+			m.Lock()
+			defer m.Unlock()
+			assert.Equal(t, tc.requests, requests)
+			if tc.failed {
+				require.Len(t, errs, 1)
+				assert.Contains(t, errs[0].Error(), "can't push 1 records to Loki")
+			} else {
+				assert.Empty(t, errs)
+			}
+		})
+	}
+}
+
+func TestLokiLabelName(t *testing.T) {
+	assert.Equal(t, "tenant_id", lokiLabelName("tenant.id"))
+	assert.Equal(t, "_1st", lokiLabelName("1st"))
+	assert.Equal(t, "_", lokiLabelName(""))
+	assert.Equal(t, `{a="1", b="with \"quotes\""}`, lokiLabelsString(map[string]string{"b": `with "quotes"`, "a": "1"}))
+}
@@ -19,3 +19,11 @@ func (h *metricsAgentLoggingHandler) Handle(record *Record) {
 	}
 	h.Handler.Handle(record)
 }
+
+// Flush flushes the decorated Handler if it implements Flusher
+func (h *metricsAgentLoggingHandler) Flush() error {
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxMsgpackLength is the maximum length of the strings, binaries, arrays and maps decoded,
+// so corrupted or hostile input can't make the decoder allocate unbounded memory.
+const maxMsgpackLength = 1 << 20
+
+// msgpackEventTime is a time encoded as the EventTime extension of the Fluentd Forward protocol.
+type msgpackEventTime time.Time
+
+// msgpackExt is a decoded extension value.
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackEncoder encodes values with the MessagePack format. It supports nil, booleans,
+// integers and floats of any size, strings, byte slices, slices and maps of interface{} values and
+// msgpackEventTime, other values are encoded as their fmt.Sprint representation.
+type msgpackEncoder struct {
+	bytes.Buffer
+}
+
+func (e *msgpackEncoder) encode(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.WriteByte(0xc0)
+	case bool:
+		if v {
+			e.WriteByte(0xc3)
+		} else {
+			e.WriteByte(0xc2)
+		}
+	case int:
+		e.encodeInt(int64(v))
+	case int8:
+		e.encodeInt(int64(v))
+	case int16:
+		e.encodeInt(int64(v))
+	case int32:
+		e.encodeInt(int64(v))
+	case int64:
+		e.encodeInt(v)
+	case uint:
+		e.encodeUint(uint64(v))
+	case uint8:
+		e.encodeUint(uint64(v))
+	case uint16:
+		e.encodeUint(uint64(v))
+	case uint32:
+		e.encodeUint(uint64(v))
+	case uint64:
+		e.encodeUint(v)
+	case float32:
+		e.WriteByte(0xca)
+		e.writeUint(uint64(math.Float32bits(v)), 4)
+	case float64:
+		e.WriteByte(0xcb)
+		e.writeUint(math.Float64bits(v), 8)
+	case string:
+		e.encodeStringHeader(len(v))
+		e.WriteString(v)
+	case []byte:
+		e.encodeBinHeader(len(v))
+		e.Write(v)
+	case []interface{}:
+		e.encodeArrayHeader(len(v))
+		for _, item := range v {
+			e.encode(item)
+		}
+	case map[string]interface{}:
+		e.encodeMap(v)
+	case msgpackEventTime:
+		t := time.Time(v)
+		e.Write([]byte{0xd7, 0x00})
+		e.writeUint(uint64(t.Unix()), 4)
+		e.writeUint(uint64(t.Nanosecond()), 4)
+	default:
+		e.encode(fmt.Sprint(v))
+	}
+}
+
+func (e *msgpackEncoder) encodeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.encodeUint(uint64(v))
+	case v >= -32:
+		e.WriteByte(byte(v))
+	case v >= math.MinInt8:
+		e.WriteByte(0xd0)
+		e.writeUint(uint64(v), 1)
+	case v >= math.MinInt16:
+		e.WriteByte(0xd1)
+		e.writeUint(uint64(v), 2)
+	case v >= math.MinInt32:
+		e.WriteByte(0xd2)
+		e.writeUint(uint64(v), 4)
+	default:
+		e.WriteByte(0xd3)
+		e.writeUint(uint64(v), 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(v uint64) {
+	switch {
+	case v < 128:
+		e.WriteByte(byte(v))
+	case v <= math.MaxUint8:
+		e.WriteByte(0xcc)
+		e.writeUint(v, 1)
+	case v <= math.MaxUint16:
+		e.WriteByte(0xcd)
+		e.writeUint(v, 2)
+	case v <= math.MaxUint32:
+		e.WriteByte(0xce)
+		e.writeUint(v, 4)
+	default:
+		e.WriteByte(0xcf)
+		e.writeUint(v, 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeStringHeader(n int) {
+	switch {
+	case n < 32:
+		e.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.WriteByte(0xd9)
+		e.writeUint(uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.WriteByte(0xda)
+		e.writeUint(uint64(n), 2)
+	default:
+		e.WriteByte(0xdb)
+		e.writeUint(uint64(n), 4)
+	}
+}
+
+func (e *msgpackEncoder) encodeBinHeader(n int) {
+	switch {
+	case n <= math.MaxUint8:
+		e.WriteByte(0xc4)
+		e.writeUint(uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.WriteByte(0xc5)
+		e.writeUint(uint64(n), 2)
+	default:
+		e.WriteByte(0xc6)
+		e.writeUint(uint64(n), 4)
+	}
+}
+
+func (e *msgpackEncoder) encodeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.WriteByte(0xdc)
+		e.writeUint(uint64(n), 2)
+	default:
+		e.WriteByte(0xdd)
+		e.writeUint(uint64(n), 4)
+	}
+}
+
+// encodeMap encodes the map with its keys sorted, so the output is deterministic.
+func (e *msgpackEncoder) encodeMap(m map[string]interface{}) {
+	switch n := len(m); {
+	case n < 16:
+		e.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.WriteByte(0xde)
+		e.writeUint(uint64(n), 2)
+	default:
+		e.WriteByte(0xdf)
+		e.writeUint(uint64(n), 4)
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e.encode(key)
+		e.encode(m[key])
+	}
+}
+
+// writeUint writes the size least significant bytes of v in big endian order.
+func (e *msgpackEncoder) writeUint(v uint64, size int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	e.Write(buf[8-size:])
+}
+
+// msgpackDecoder decodes MessagePack values into nil, bool, int64, uint64, float64, string,
+// []byte, []interface{}, map[interface{}]interface{} and msgpackExt values. Only maps with
+// scalar keys are supported, and lengths are limited to maxMsgpackLength.
+type msgpackDecoder struct {
+	r *bufio.Reader
+}
+
+func newMsgpackDecoder(r io.Reader) *msgpackDecoder {
+	return &msgpackDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return d.decodeMap(int(b & 0x0f))
+	case b&0xf0 == 0x90:
+		return d.decodeArray(int(b & 0x0f))
+	case b&0xe0 == 0xa0:
+		return d.readString(int(b & 0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLength(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLength(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.readExt(n)
+	case 0xca:
+		v, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.readUint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (b - 0xcc))
+	case 0xd0:
+		v, err := d.readUint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.readUint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.readUint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.readUint(8)
+		return int64(v), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.readExt(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLength(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLength(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLength(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	default:
+		return nil, fmt.Errorf("unsupported msgpack type 0x%x", b)
+	}
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	array := make([]interface{}, n)
+	for i := range array {
+		item, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		array[i] = item
+	}
+	return array, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	m := make(map[interface{}]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case nil, bool, int64, uint64, float64, string:
+		case []byte:
+			key = string(k)
+		default:
+			return nil, fmt.Errorf("unsupported msgpack map key of type %T", key)
+		}
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func (d *msgpackDecoder) readExt(n int) (interface{}, error) {
+	extType, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return msgpackExt{Type: int8(extType), Data: data}, nil
+}
+
+func (d *msgpackDecoder) readString(n int) (interface{}, error) {
+	data, err := d.readBytes(n)
+	return string(data), err
+}
+
+func (d *msgpackDecoder) readBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	_, err := io.ReadFull(d.r, data)
+	return data, err
+}
+
+// readLength reads a length of the given size, failing if it exceeds maxMsgpackLength.
+func (d *msgpackDecoder) readLength(size int) (int, error) {
+	n, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > maxMsgpackLength {
+		return 0, fmt.Errorf("msgpack length %d exceeds the maximum of %d", n, maxMsgpackLength)
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
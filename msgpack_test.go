@@ -0,0 +1,76 @@
+package log
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"nil", nil, nil},
+		{"true", true, true},
+		{"false", false, false},
+		{"positive fixint", 7, int64(7)},
+		{"uint8", 200, uint64(200)},
+		{"uint16", 60000, uint64(60000)},
+		{"uint32", 1 << 31, uint64(1 << 31)},
+		{"uint64", uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{"negative fixint", -5, int64(-5)},
+		{"int8", -100, int64(-100)},
+		{"int16", -30000, int64(-30000)},
+		{"int32", -1 << 30, int64(-1 << 30)},
+		{"int64", int64(math.MinInt64), int64(math.MinInt64)},
+		{"float", 1.5, 1.5},
+		{"float32", float32(1.5), 1.5},
+		{"sized ints", []interface{}{int8(-1), int16(-300), int32(-70000), uint(1), uint8(200), uint16(300), uint32(70000)},
+			[]interface{}{int64(-1), int64(-300), int64(-70000), int64(1), uint64(200), uint64(300), uint64(70000)}},
+		{"fixstr", "hello", "hello"},
+		{"str8", strings.Repeat("a", 200), strings.Repeat("a", 200)},
+		{"str16", strings.Repeat("a", 70000), strings.Repeat("a", 70000)},
+		{"bin", []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"array", []interface{}{1, "a"}, []interface{}{int64(1), "a"}},
+		{"map", map[string]interface{}{"a": 1}, map[interface{}]interface{}{"a": int64(1)}},
+		{"other", Level(3), "3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc := &msgpackEncoder{}
+			enc.encode(tc.value)
+			decoded, err := newMsgpackDecoder(bytes.NewReader(enc.Bytes())).decode()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, decoded)
+		})
+	}
+}
+
+func TestMsgpackEventTime(t *testing.T) {
+	enc := &msgpackEncoder{}
+	enc.encode(msgpackEventTime(testRecordTime))
+	assert.Equal(t, []byte{0xd7, 0x00, 0x5b, 0x1e, 0x6c, 0x86, 0x07, 0x5b, 0xca, 0x00}, enc.Bytes())
+}
+
+func TestMsgpackDecoderRejectsInvalidInput(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"array key":       {0x81, 0x91, 0x01, 0x01},
+		"map key":         {0x81, 0x81, 0x01, 0x01, 0x01},
+		"long array":      {0xdd, 0xff, 0xff, 0xff, 0xff},
+		"long map":        {0xdf, 0xff, 0xff, 0xff, 0xff},
+		"long string":     {0xdb, 0xff, 0xff, 0xff, 0xff},
+		"long binary":     {0xc6, 0xff, 0xff, 0xff, 0xff},
+		"long extension":  {0xc9, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"truncated array": {0x92, 0x01},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newMsgpackDecoder(bytes.NewReader(data)).decode()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -39,6 +39,11 @@ func (b *MultiHandler) Handle(rec *Record) {
 	wg.Wait()
 }
 
+// Flush flushes concurrently the handlers that implement Flusher.
+func (b *MultiHandler) Flush() error {
+	return flushHandlers(b.handlers)
+}
+
 func (b *MultiHandler) Close() error {
 	var result error
 	var m sync.Mutex
@@ -0,0 +1,160 @@
+package log
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// connConfig configures the connections of the handlers writing to network peers.
+type connConfig struct {
+	Network   string
+	Address   string
+	TLSConfig *tls.Config
+	// DialTimeout is the timeout of each dial, DefaultNetDialTimeout by default.
+	DialTimeout time.Duration
+	// WriteTimeout is the deadline of each write, DefaultNetWriteTimeout by default.
+	WriteTimeout time.Duration
+	// MinBackoff is the wait before dialing again after failing, doubled on each failure,
+	// DefaultNetMinBackoff by default.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum wait between dials, DefaultNetMaxBackoff by default.
+	MaxBackoff time.Duration
+}
+
+// reconnectingConn is a connection that is dialed again when using it fails. Dials are spaced
+// with exponential backoff, and uses fail without dialing while waiting for it, so callers
+// aren't blocked while the peer is down.
+type reconnectingConn struct {
+	cfg    connConfig
+	ctx    context.Context // Canceled on Close to abort dials in progress
+	cancel context.CancelFunc
+
+	m       sync.Mutex
+	conn    net.Conn
+	backoff time.Duration
+	retryAt time.Time
+	lastErr error
+}
+
+// dialReconnecting returns a reconnectingConn already connected with the given configuration.
+func dialReconnecting(cfg connConfig) (*reconnectingConn, error) {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultNetDialTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultNetWriteTimeout
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultNetMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultNetMaxBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &reconnectingConn{cfg: cfg, ctx: ctx, cancel: cancel}
+	conn, err := c.dial()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	c.conn = conn
+	return c, nil
+}
+
+// Write writes b to the connection within the write timeout, see use.
+func (c *reconnectingConn) Write(b []byte) (int, error) {
+	var n int
+	err := c.use(func(conn net.Conn) error {
+		var err error
+		n, err = c.write(conn, b)
+		return err
+	})
+	return n, err
+}
+
+// use calls fn with the connection, dialing it first if it's not connected. If fn fails, the
+// connection is closed and, if it had been used before, fn is retried once with a new one,
+// since the peer may have closed it while idle. Otherwise the next dial waits for the backoff.
+func (c *reconnectingConn) use(fn func(conn net.Conn) error) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for {
+		reused := c.conn != nil
+		if c.conn == nil {
+			if time.Now().Before(c.retryAt) {
+				return fmt.Errorf("not connected, waiting to dial again after: %v", c.lastErr)
+			}
+			conn, err := c.dial()
+			if err != nil {
+				return c.fail(err)
+			}
+			c.conn = conn
+		}
+
+		err := fn(c.conn)
+		if err == nil {
+			c.backoff = 0
+			return nil
+		}
+		c.conn.Close()
+		c.conn = nil
+		if !reused {
+			return c.fail(err)
+		}
+	}
+}
+
+// write writes b to conn within the write timeout.
+func (c *reconnectingConn) write(conn net.Conn, b []byte) (int, error) {
+	if err := conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout)); err != nil {
+		return 0, err
+	}
+	return conn.Write(b)
+}
+
+// nextDial returns the time after which the connection can be dialed again.
+func (c *reconnectingConn) nextDial() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.retryAt
+}
+
+// Close aborts the dials in progress and closes the current connection, if any.
+func (c *reconnectingConn) Close() error {
+	c.cancel()
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *reconnectingConn) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.DialTimeout}
+	if c.cfg.TLSConfig != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: c.cfg.TLSConfig}).DialContext(c.ctx, c.cfg.Network, c.cfg.Address)
+	}
+	return dialer.DialContext(c.ctx, c.cfg.Network, c.cfg.Address)
+}
+
+// fail schedules the next dial after the backoff, doubled on each consecutive failure, and returns err.
+func (c *reconnectingConn) fail(err error) error {
+	if c.backoff *= 2; c.backoff < c.cfg.MinBackoff {
+		c.backoff = c.cfg.MinBackoff
+	}
+	if c.backoff > c.cfg.MaxBackoff {
+		c.backoff = c.cfg.MaxBackoff
+	}
+	c.retryAt = time.Now().Add(c.backoff)
+	c.lastErr = err
+	return err
+}
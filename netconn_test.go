@@ -0,0 +1,37 @@
+package log
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectingConnBacksOffWhileDisconnected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	c, err := dialReconnecting(connConfig{Network: "tcp", Address: listener.Addr().String(), MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	require.NoError(t, err)
+	defer c.Close()
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	_, err = c.Write([]byte("connected"))
+	assert.NoError(t, err)
+	conn.Close()
+	listener.Close()
+
+	// The first write may succeed before the closed connection is noticed.
+	for i := 0; i < 3 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err = c.Write([]byte("disconnected"))
+	}
+	require.Error(t, err)
+
+	_, err = c.Write([]byte("waiting"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiting to dial again")
+	assert.True(t, c.nextDial().After(time.Now().Add(time.Minute)))
+}
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NetFraming is the framing of the records sent by NetHandler over stream connections.
+type NetFraming int
+
+// Net framings.
+const (
+	// NewlineFraming terminates each record with a line feed.
+	NewlineFraming NetFraming = iota
+	// LengthPrefixFraming prefixes each record with its length as a big endian 32 bit integer.
+	LengthPrefixFraming
+)
+
+// Defaults of NetConfig.
+const (
+	DefaultNetBufferSize   = 1000
+	DefaultNetDialTimeout  = 5 * time.Second
+	DefaultNetWriteTimeout = 5 * time.Second
+	DefaultNetMinBackoff   = 100 * time.Millisecond
+	DefaultNetMaxBackoff   = 30 * time.Second
+)
+
+// NetConfig configures a NetHandler.
+type NetConfig struct {
+	// Network is "tcp", "udp", "unix" or "unixgram".
+	Network string
+	// Address to connect to, like "localhost:5000" or a socket path.
+	Address string
+	// Framing of the records on stream connections, NewlineFraming by default.
+	// Records sent over datagram connections are sent one per datagram without framing.
+	Framing NetFraming
+	// TLSConfig enables TLS on "tcp" connections, client certificates can be set in it.
+	TLSConfig *tls.Config
+	// BufferSize is the maximum number of records buffered while disconnected, the oldest
+	// ones are dropped when it's full. DefaultNetBufferSize by default.
+	BufferSize int
+	// DialTimeout is the timeout of each dial, DefaultNetDialTimeout by default.
+	DialTimeout time.Duration
+	// WriteTimeout is the deadline of each write, DefaultNetWriteTimeout by default.
+	WriteTimeout time.Duration
+	// MinBackoff is the wait before dialing again after failing, doubled on each failure,
+	// DefaultNetMinBackoff by default.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum wait between dials, DefaultNetMaxBackoff by default.
+	MaxBackoff time.Duration
+}
+
+// NetHandler writes the formatted records to a network connection. Records are written from
+// a goroutine, and buffered while the connection is dialed again after errors, with exponential
+// backoff. Connection errors are reported with OnHandlerError.
+type NetHandler struct {
+	dropped uint64 // accessed atomically, first to be 64-bit aligned on 32-bit platforms
+
+	*BaseHandler
+	cfg      NetConfig
+	conn     *reconnectingConn
+	datagram bool
+
+	m            sync.Mutex
+	cond         *sync.Cond
+	queue        [][]byte
+	writing      bool
+	reconnecting bool
+	closed       bool
+	closing      chan struct{}
+	stopped      chan struct{}
+}
+
+// NewNetHandler returns a NetHandler connected to the configured address.
+func NewNetHandler(cfg NetConfig) (*NetHandler, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultNetBufferSize
+	}
+
+	h := &NetHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		closing:     make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	h.cond = sync.NewCond(&h.m)
+
+	conn := connConfig{
+		Network:      cfg.Network,
+		Address:      cfg.Address,
+		DialTimeout:  cfg.DialTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		MinBackoff:   cfg.MinBackoff,
+		MaxBackoff:   cfg.MaxBackoff,
+	}
+	switch cfg.Network {
+	case "tcp", "tcp4", "tcp6":
+		conn.TLSConfig = cfg.TLSConfig
+	case "unix":
+	case "udp", "udp4", "udp6", "unixgram":
+		h.datagram = true
+	default:
+		return nil, fmt.Errorf("unsupported network %q", cfg.Network)
+	}
+
+	var err error
+	if h.conn, err = dialReconnecting(conn); err != nil {
+		return nil, err
+	}
+	go h.run()
+	return h, nil
+}
+
+// NewTLSConfig returns a TLS configuration trusting the CA certificates of caFile, or the
+// system ones if empty, and presenting the client certificate of certFile and keyFile, if not empty.
+func NewTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (h *NetHandler) Handle(rec *Record) {
+	message := h.BaseHandler.FilterAndFormat(rec)
+	if message == "" {
+		return
+	}
+	h.enqueue(h.frame(strings.TrimSuffix(message, "\n")))
+}
+
+// Dropped returns the number of records dropped because the buffer was full.
+func (h *NetHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Flush waits until the buffered records are written, or the handler is closed. It fails
+// without waiting while the connection is being dialed again, since that can take until
+// MaxBackoff after the peer is back.
+func (h *NetHandler) Flush() error {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for (len(h.queue) > 0 || h.writing) && !h.closed && !h.reconnecting {
+		h.cond.Wait()
+	}
+	if h.reconnecting && len(h.queue) > 0 {
+		return fmt.Errorf("can't flush %d records to %s %s while reconnecting", len(h.queue), h.cfg.Network, h.cfg.Address)
+	}
+	return nil
+}
+
+// Close writes the buffered records if connected and closes the connection.
+func (h *NetHandler) Close() error {
+	h.m.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.closing)
+		h.cond.Broadcast()
+	}
+	h.m.Unlock()
+
+	<-h.stopped
+	return h.conn.Close()
+}
+
+func (h *NetHandler) frame(message string) []byte {
+	if h.datagram {
+		return []byte(message)
+	}
+	if h.cfg.Framing == LengthPrefixFraming {
+		frame := make([]byte, 4, 4+len(message))
+		binary.BigEndian.PutUint32(frame, uint32(len(message)))
+		return append(frame, message...)
+	}
+	return []byte(message + "\n")
+}
+
+// enqueue buffers the frame, dropping the oldest one if the buffer is full.
+func (h *NetHandler) enqueue(frame []byte) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.closed {
+		return
+	}
+	if len(h.queue) >= h.cfg.BufferSize {
+		h.queue = h.queue[1:]
+		atomic.AddUint64(&h.dropped, 1)
+	}
+	h.queue = append(h.queue, frame)
+	h.cond.Broadcast()
+}
+
+// run writes the buffered frames until the handler is closed.
+func (h *NetHandler) run() {
+	defer close(h.stopped)
+	for {
+		h.m.Lock()
+		for len(h.queue) == 0 && !h.closed {
+			h.cond.Wait()
+		}
+		if len(h.queue) == 0 {
+			h.m.Unlock()
+			return
+		}
+		frame := h.queue[0]
+		h.queue = h.queue[1:]
+		h.writing = true
+		h.m.Unlock()
+
+		_, err := h.conn.Write(frame)
+
+		h.m.Lock()
+		h.writing = false
+		if err != nil {
+			// The frame is buffered again, unless newer ones filled the buffer meanwhile.
+			if len(h.queue) < h.cfg.BufferSize {
+				h.queue = append([][]byte{frame}, h.queue...)
+			} else {
+				atomic.AddUint64(&h.dropped, 1)
+			}
+		}
+		disconnected := err != nil && !h.reconnecting
+		h.reconnecting = err != nil
+		h.cond.Broadcast()
+		h.m.Unlock()
+
+		if disconnected {
+			OnHandlerError(fmt.Errorf("can't write to %s %s, reconnecting: %v", h.cfg.Network, h.cfg.Address, err))
+		}
+		if err != nil && !h.waitToDial() {
+			h.m.Lock()
+			h.queue = nil
+			h.cond.Broadcast()
+			h.m.Unlock()
+			return
+		}
+	}
+}
+
+// waitToDial waits until the connection can be dialed again after failing to write.
+// It returns false if the handler is closed before.
+func (h *NetHandler) waitToDial() bool {
+	timer := time.NewTimer(time.Until(h.conn.nextDial()))
+	defer timer.Stop()
+	select {
+	case <-h.closing:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
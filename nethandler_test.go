@@ -0,0 +1,235 @@
+package log
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetHandlerNewlineFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := acceptNetLines(t, listener)
+
+	h, err := NewNetHandler(NetConfig{Network: "tcp", Address: listener.Addr().String()})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "first\n"})
+	h.Handle(&Record{Level: ERROR, Message: "second"})
+	require.NoError(t, h.Flush())
+
+	assert.Equal(t, "first", <-lines)
+	assert.Equal(t, "second", <-lines)
+}
+
+func TestNetHandlerLengthPrefixFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var size uint32
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return
+			}
+			message := make([]byte, size)
+			if _, err := io.ReadFull(conn, message); err != nil {
+				return
+			}
+			messages <- string(message)
+		}
+	}()
+
+	h, err := NewNetHandler(NetConfig{Network: "unix", Address: path, Framing: LengthPrefixFraming})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "multi\nline"})
+	h.Handle(&Record{Level: ERROR, Message: "second"})
+
+	assert.Equal(t, "multi\nline", <-messages)
+	assert.Equal(t, "second", <-messages)
+}
+
+func TestNetHandlerUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h, err := NewNetHandler(NetConfig{Network: "udp", Address: listener.LocalAddr().String()})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "datagram\n"})
+
+	buf := make([]byte, 100)
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "datagram", string(buf[:n]))
+}
+
+func TestNetHandlerTLS(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := acceptNetLines(t, listener)
+
+	h, err := NewNetHandler(NetConfig{Network: "tcp", Address: listener.Addr().String(), TLSConfig: clientConfig})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "encrypted"})
+	assert.Equal(t, "encrypted", <-lines)
+}
+
+func TestNetHandlerBuffersWhileReconnecting(t *testing.T) {
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(error) {}
+	defer func() { OnHandlerError = onHandlerError }()
+
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	connected := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		connected <- line
+	}()
+
+	h, err := NewNetHandler(NetConfig{
+		Network:    "unix",
+		Address:    path,
+		BufferSize: 2,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "connected"})
+	assert.Equal(t, "connected\n", <-connected)
+	require.NoError(t, listener.Close())
+
+	messages := []string{"1", "2", "3", "4", "5"}
+	for _, message := range messages {
+		h.Handle(&Record{Level: ERROR, Message: message})
+	}
+
+	listener, err = net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := acceptNetLines(t, listener)
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Flush() != nil {
+		require.True(t, time.Now().Before(deadline), "handler didn't reconnect")
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, h.Close())
+
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	require.True(t, len(received) >= 2, "received %v", received)
+	assert.Equal(t, []string{"4", "5"}, received[len(received)-2:])
+	assert.Equal(t, uint64(len(messages)-len(received)), h.Dropped())
+}
+
+func TestNetHandlerFlushDoesNotWaitWhileReconnecting(t *testing.T) {
+	var m sync.Mutex
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) {
+		m.Lock()
+		defer m.Unlock()
+		errs = append(errs, err)
+	}
+	defer func() { OnHandlerError = onHandlerError }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	h, err := NewNetHandler(NetConfig{Network: "tcp", Address: listener.Addr().String(), MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	require.NoError(t, err)
+	h.SetFormatter(messageFormatter{})
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	conn.Close()
+	listener.Close()
+
+	flushed := make(chan error, 1)
+	go func() {
+		for {
+			h.Handle(&Record{Level: ERROR, Message: "lost"})
+			if err := h.Flush(); err != nil {
+				flushed <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-flushed:
+		assert.Contains(t, err.Error(), "while reconnecting")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Flush blocked while reconnecting")
+	}
+	require.NoError(t, h.Close())
+
+	m.Lock()
+	defer m.Unlock()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "reconnecting")
+}
+
+// acceptNetLines accepts a connection and sends the lines read from it to the returned
+// channel, which is closed when the connection is closed.
+func acceptNetLines(t *testing.T, listener net.Listener) <-chan string {
+	lines := make(chan string, 10)
+	go func() {
+		defer close(lines)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSuffix(line, "\n")
+		}
+	}()
+	return lines
+}
@@ -1,5 +1,10 @@
 package log
 
+import (
+	"context"
+	"time"
+)
+
 // NoDebugLogger embeds a Logger, but in calls to debug functions it does nothing.
 // It avoids doing fmt.Sprintf() for those calls as they will be discarded anyways.
 // This makes those calls like 50 times faster (see benchmark file)
@@ -10,3 +15,39 @@ type NoDebugLogger struct {
 func (NoDebugLogger) Debug(args ...interface{})                 {}
 func (NoDebugLogger) Debugf(format string, args ...interface{}) {}
 func (NoDebugLogger) Debugln(args ...interface{})               {}
+
+// SetStackLevel sets the stack level of the embedded Logger if it implements StackLeveler.
+func (l NoDebugLogger) SetStackLevel(level Level) {
+	if s, ok := l.Logger.(StackLeveler); ok {
+		s.SetStackLevel(level)
+	}
+}
+
+// SetClock sets the clock of the embedded Logger if it implements ClockSetter.
+func (l NoDebugLogger) SetClock(clock func() time.Time) {
+	if c, ok := l.Logger.(ClockSetter); ok {
+		c.SetClock(clock)
+	}
+}
+
+// WithError returns a NoDebugLogger wrapping the logger returned by the embedded Logger.
+func (l NoDebugLogger) WithError(err error) Logger {
+	return NoDebugLogger{Logger: withError(l.Logger, err)}
+}
+
+// enabled discards debug records unless they may be held in the request buffer.
+func (l NoDebugLogger) enabled(level Level, buffer *requestBuffer) bool {
+	if level == DEBUG && !buffer.active() {
+		return false
+	}
+	e, ok := l.Logger.(contextEmitter)
+	return !ok || e.enabled(level, buffer)
+}
+
+func (l NoDebugLogger) emit(ctx context.Context, buffer *requestBuffer, level Level, message string) {
+	emit(l.Logger, ctx, buffer, level, message)
+}
+
+func (l NoDebugLogger) fatal(ctx context.Context, buffer *requestBuffer, message string) {
+	fatal(l.Logger, ctx, buffer, message)
+}
@@ -0,0 +1,503 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLPEncoding is the encoding of the requests sent by OTLPHandler.
+type OTLPEncoding int
+
+// OTLP/HTTP encodings.
+const (
+	// OTLPProtobuf sends the logs as binary protocol buffers.
+	OTLPProtobuf OTLPEncoding = iota
+	// OTLPJSON sends the logs as JSON.
+	OTLPJSON
+)
+
+// Defaults of OTLPConfig.
+const (
+	DefaultOTLPBatchSize     = 512
+	DefaultOTLPFlushInterval = time.Second
+	DefaultOTLPMaxRetries    = 5
+	DefaultOTLPMinBackoff    = 500 * time.Millisecond
+	DefaultOTLPMaxBackoff    = 30 * time.Second
+	DefaultOTLPTimeout       = 10 * time.Second
+)
+
+// Baggage keys of the trace context of records, used by OTLPHandler unless OTLPConfig.SpanContext is set.
+const (
+	TraceIDBaggageKey = "trace_id"
+	SpanIDBaggageKey  = "span_id"
+)
+
+// otlpSeverities maps levels to OpenTelemetry severity numbers.
+var otlpSeverities = map[Level]int{
+	CRITICAL: 21, // FATAL
+	ERROR:    17, // ERROR
+	WARNING:  13, // WARN
+	NOTICE:   10, // INFO2
+	INFO:     9,  // INFO
+	DEBUG:    5,  // DEBUG
+}
+
+// OTLPConfig configures an OTLPHandler.
+type OTLPConfig struct {
+	// Endpoint is the URL of the logs endpoint, like "http://localhost:4318/v1/logs".
+	Endpoint string
+	// Encoding of the requests, OTLPProtobuf by default.
+	Encoding OTLPEncoding
+	// Headers are added to every request, like authentication headers.
+	Headers map[string]string
+	// ResourceAttributes are added to the resource of the logs, like "service.name".
+	ResourceAttributes map[string]string
+	// SpanContext returns the hex encoded trace and span IDs of the context of the records, like
+	// the span of an OpenTelemetry tracer. When nil, or for records without context, they are
+	// taken from the TraceIDBaggageKey and SpanIDBaggageKey baggage keys.
+	SpanContext func(ctx context.Context) (traceID, spanID string)
+	// BatchSize is the maximum number of records of each request, DefaultOTLPBatchSize by default.
+	BatchSize int
+	// FlushInterval is the maximum time a record waits to be sent, DefaultOTLPFlushInterval by default.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a request is sent again after failing, DefaultOTLPMaxRetries
+	// by default, negative to never retry.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry, doubled on each retry, DefaultOTLPMinBackoff by default.
+	// The Retry-After header of the responses is honored instead, if present.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum wait between retries, including the Retry-After of the
+	// responses, DefaultOTLPMaxBackoff by default.
+	MaxBackoff time.Duration
+	// Client sends the requests, a client with a DefaultOTLPTimeout timeout by default.
+	Client *http.Client
+}
+
+// OTLPHandler exports the logging output as OpenTelemetry logs with the OTLP/HTTP protocol.
+// Records are sent in batches as log records with the severity of their level, their message
+// as body and their baggage as attributes, grouped in instrumentation scopes by logger name.
+// The resource of the logs has the process name and pid as attributes. Requests failing with
+// network errors, 429, 502, 503 or 504 responses are retried, and batches that can't be sent
+// are dropped, reporting the error with OnHandlerError. The formatter is not used.
+type OTLPHandler struct {
+	*BaseHandler
+	cfg       OTLPConfig
+	resource  []otlpAttribute
+	batcher   *batcher
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewOTLPHandler returns an OTLPHandler exporting to the configured endpoint.
+func NewOTLPHandler(cfg OTLPConfig) (*OTLPHandler, error) {
+	if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %v", err)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultOTLPBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultOTLPFlushInterval
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultOTLPMaxRetries
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultOTLPMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultOTLPMaxBackoff
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultOTLPTimeout}
+	}
+
+	resource := map[string]interface{}{
+		"process.executable.name": procName,
+		"process.pid":             pid,
+	}
+	for key, value := range cfg.ResourceAttributes {
+		resource[key] = value
+	}
+
+	h := &OTLPHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		resource:    otlpAttributes(resource),
+		closing:     make(chan struct{}),
+	}
+	h.batcher = newBatcher(cfg.BatchSize, cfg.FlushInterval, h.send)
+	return h, nil
+}
+
+func (h *OTLPHandler) Handle(rec *Record) {
+	if !h.BaseHandler.Filter(rec) {
+		return
+	}
+	h.batcher.add(h.withSpanContext(rec))
+}
+
+// withSpanContext returns a copy of the record with the trace and span IDs returned by
+// SpanContext in its baggage, since batched records don't keep their context.
+func (h *OTLPHandler) withSpanContext(rec *Record) *Record {
+	if h.cfg.SpanContext == nil || rec.Context == nil {
+		return rec
+	}
+	traceID, spanID := h.cfg.SpanContext(rec.Context)
+	baggage := make(map[string]interface{}, len(rec.Baggage)+2)
+	for key, value := range rec.Baggage {
+		baggage[key] = value
+	}
+	baggage[TraceIDBaggageKey], baggage[SpanIDBaggageKey] = traceID, spanID
+
+	copied := *rec
+	copied.Baggage = baggage
+	return &copied
+}
+
+// Flush sends the pending records.
+func (h *OTLPHandler) Flush() error {
+	h.batcher.flush()
+	return nil
+}
+
+// Close sends the pending records, without waiting to retry the failed requests.
+func (h *OTLPHandler) Close() error {
+	h.closeOnce.Do(func() { close(h.closing) })
+	h.batcher.close()
+	return nil
+}
+
+// otlpAttribute is a key-value pair of OTLP attributes, with a string, int64, float64 or bool value.
+type otlpAttribute struct {
+	key   string
+	value interface{}
+}
+
+// otlpScope are the log records of an instrumentation scope.
+type otlpScope struct {
+	name    string
+	records []otlpLogRecord
+}
+
+type otlpLogRecord struct {
+	time       time.Time
+	severity   int
+	level      string
+	body       string
+	attributes []otlpAttribute
+	traceID    []byte
+	spanID     []byte
+}
+
+// send exports a batch, retrying with exponential backoff or the Retry-After of the responses.
+func (h *OTLPHandler) send(batch []*Record) {
+	scopes := h.scopes(batch)
+	var body []byte
+	var contentType string
+	if h.cfg.Encoding == OTLPJSON {
+		body, contentType = h.encodeJSON(scopes), "application/json"
+	} else {
+		body, contentType = h.encodeProtobuf(scopes), "application/x-protobuf"
+	}
+
+	backoff := h.cfg.MinBackoff
+	for retry := 0; ; retry++ {
+		retryAfter, retryable, err := h.export(body, contentType)
+		if err == nil {
+			return
+		}
+		if !retryable || retry >= h.cfg.MaxRetries || !h.wait(backoff, retryAfter) {
+			OnHandlerError(fmt.Errorf("can't export %d records with OTLP: %v", len(batch), err))
+			return
+		}
+		if retryAfter == 0 {
+			if backoff *= 2; backoff > h.cfg.MaxBackoff {
+				backoff = h.cfg.MaxBackoff
+			}
+		}
+	}
+}
+
+// wait waits for the Retry-After of the response, capped to MaxBackoff, or for the backoff if
+// the response had none. It returns false if the handler is closed before.
+func (h *OTLPHandler) wait(backoff, retryAfter time.Duration) bool {
+	if retryAfter > 0 {
+		backoff = retryAfter
+		if backoff > h.cfg.MaxBackoff {
+			backoff = h.cfg.MaxBackoff
+		}
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-h.closing:
+		return false
+	}
+}
+
+// scopes groups the records of the batch by logger name, in order of appearance.
+func (h *OTLPHandler) scopes(batch []*Record) []*otlpScope {
+	var scopes []*otlpScope
+	byName := map[string]*otlpScope{}
+	for _, rec := range batch {
+		scope, ok := byName[rec.LoggerName]
+		if !ok {
+			scope = &otlpScope{name: rec.LoggerName}
+			byName[rec.LoggerName] = scope
+			scopes = append(scopes, scope)
+		}
+		scope.records = append(scope.records, h.logRecord(rec))
+	}
+	return scopes
+}
+
+func (h *OTLPHandler) logRecord(rec *Record) otlpLogRecord {
+	attributes := map[string]interface{}{}
+	for key, value := range rec.Baggage {
+		if key != TraceIDBaggageKey && key != SpanIDBaggageKey {
+			attributes[key] = value
+		}
+	}
+	if rec.Filename != "" {
+		attributes["code.filepath"] = rec.Filename
+		attributes["code.lineno"] = rec.Line
+	}
+	if rec.Function != "" {
+		attributes["code.function"] = rec.Function
+	}
+	if len(rec.Errors) > 0 {
+		attributes["exception.type"] = rec.Errors[0].Type
+		attributes["exception.message"] = rec.Errors[0].Message
+	}
+	if len(rec.Stack) > 0 {
+		attributes["exception.stacktrace"] = rec.Stack.String()
+	}
+
+	logRecord := otlpLogRecord{
+		time:       rec.Time,
+		severity:   otlpSeverities[rec.Level],
+		level:      LevelNames[rec.Level],
+		body:       strings.TrimSuffix(rec.Message, "\n"),
+		attributes: otlpAttributes(attributes),
+	}
+	traceID, _ := rec.Baggage[TraceIDBaggageKey].(string)
+	spanID, _ := rec.Baggage[SpanIDBaggageKey].(string)
+	if id, err := hex.DecodeString(traceID); err == nil && len(id) == 16 {
+		logRecord.traceID = id
+	}
+	if id, err := hex.DecodeString(spanID); err == nil && len(id) == 8 {
+		logRecord.spanID = id
+	}
+	return logRecord
+}
+
+// export sends an export request, and returns whether it can be retried when it fails
+// and the time to wait before retrying, if the response has a Retry-After header.
+func (h *OTLPHandler) export(body []byte, contentType string) (retryAfter time.Duration, retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, h.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range h.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return 0, false, nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return parseRetryAfter(resp.Header.Get("Retry-After")), true, err
+	default:
+		return 0, false, err
+	}
+}
+
+// encodeJSON encodes the scopes as an ExportLogsServiceRequest with the OTLP/JSON encoding.
+func (h *OTLPHandler) encodeJSON(scopes []*otlpScope) []byte {
+	type object = map[string]interface{}
+
+	scopeLogs := make([]object, len(scopes))
+	for i, scope := range scopes {
+		logRecords := make([]object, len(scope.records))
+		for j, rec := range scope.records {
+			logRecord := object{
+				"timeUnixNano":         strconv.FormatInt(rec.time.UnixNano(), 10),
+				"observedTimeUnixNano": strconv.FormatInt(rec.time.UnixNano(), 10),
+				"severityNumber":       rec.severity,
+				"severityText":         rec.level,
+				"body":                 otlpJSONValue(rec.body),
+				"attributes":           otlpJSONAttributes(rec.attributes),
+			}
+			if rec.traceID != nil {
+				logRecord["traceId"] = hex.EncodeToString(rec.traceID)
+			}
+			if rec.spanID != nil {
+				logRecord["spanId"] = hex.EncodeToString(rec.spanID)
+			}
+			logRecords[j] = logRecord
+		}
+		scopeLogs[i] = object{
+			"scope":      object{"name": scope.name},
+			"logRecords": logRecords,
+		}
+	}
+
+	body, _ := json.Marshal(object{
+		"resourceLogs": []object{{
+			"resource":  object{"attributes": otlpJSONAttributes(h.resource)},
+			"scopeLogs": scopeLogs,
+		}},
+	})
+	return body
+}
+
+// encodeProtobuf encodes the scopes as an ExportLogsServiceRequest protocol buffers message.
+func (h *OTLPHandler) encodeProtobuf(scopes []*otlpScope) []byte {
+	req := &protoEncoder{}
+	req.messageField(1, func(resourceLogs *protoEncoder) {
+		resourceLogs.messageField(1, func(resource *protoEncoder) {
+			otlpProtoAttributes(resource, 1, h.resource)
+		})
+		for _, scope := range scopes {
+			resourceLogs.messageField(2, func(scopeLogs *protoEncoder) {
+				scopeLogs.messageField(1, func(s *protoEncoder) { s.stringField(1, scope.name) })
+				for _, rec := range scope.records {
+					scopeLogs.messageField(2, func(r *protoEncoder) {
+						r.fixed64Field(1, uint64(rec.time.UnixNano()))
+						r.uintField(2, uint64(rec.severity))
+						r.stringField(3, rec.level)
+						r.messageField(5, func(v *protoEncoder) { otlpProtoValue(v, rec.body) })
+						otlpProtoAttributes(r, 6, rec.attributes)
+						r.bytesField(9, rec.traceID)
+						r.bytesField(10, rec.spanID)
+						r.fixed64Field(11, uint64(rec.time.UnixNano()))
+					})
+				}
+			})
+		}
+	})
+	return req.Bytes()
+}
+
+// otlpAttributes returns the attributes sorted by key, with values converted to OTLP types.
+func otlpAttributes(m map[string]interface{}) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(m))
+	for key, value := range m {
+		switch v := value.(type) {
+		case string, bool, int64, float64:
+		case int:
+			value = int64(v)
+		case int32:
+			value = int64(v)
+		case uint32:
+			value = int64(v)
+		case float32:
+			value = float64(v)
+		default:
+			value = fmt.Sprint(v)
+		}
+		attributes = append(attributes, otlpAttribute{key: key, value: value})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].key < attributes[j].key })
+	return attributes
+}
+
+func otlpJSONAttributes(attributes []otlpAttribute) []map[string]interface{} {
+	kvs := make([]map[string]interface{}, len(attributes))
+	for i, attribute := range attributes {
+		kvs[i] = map[string]interface{}{"key": attribute.key, "value": otlpJSONValue(attribute.value)}
+	}
+	return kvs
+}
+
+// otlpJSONValue returns the AnyValue of v, with integers as strings as required by OTLP/JSON.
+func otlpJSONValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+func otlpProtoAttributes(e *protoEncoder, field int, attributes []otlpAttribute) {
+	for _, attribute := range attributes {
+		e.messageField(field, func(kv *protoEncoder) {
+			kv.stringField(1, attribute.key)
+			kv.messageField(2, func(v *protoEncoder) { otlpProtoValue(v, attribute.value) })
+		})
+	}
+}
+
+// otlpProtoValue encodes the fields of the AnyValue of v. Values of the oneof are
+// encoded even if they are zero values.
+func otlpProtoValue(e *protoEncoder, v interface{}) {
+	switch v := v.(type) {
+	case bool:
+		e.key(2, protoVarint)
+		if v {
+			e.varint(1)
+		} else {
+			e.varint(0)
+		}
+	case int64:
+		e.key(3, protoVarint)
+		e.varint(uint64(v))
+	case float64:
+		e.key(4, protoFixed64)
+		e.fixed64(math.Float64bits(v))
+	default:
+		s := fmt.Sprint(v)
+		e.key(1, protoBytes)
+		e.varint(uint64(len(s)))
+		e.WriteString(s)
+	}
+}
+
+// parseRetryAfter returns the wait of a Retry-After header, as seconds or as an HTTP date,
+// or zero if it's empty or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,283 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPHandlerJSON(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	h, err := NewOTLPHandler(OTLPConfig{
+		Endpoint:           server.URL + "/v1/logs",
+		Encoding:           OTLPJSON,
+		Headers:            map[string]string{"Authorization": "Bearer token"},
+		ResourceAttributes: map[string]string{"service.name": "payments"},
+		FlushInterval:      time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{
+		Level:      ERROR,
+		Time:       testRecordTime,
+		Message:    "something failed\n",
+		LoggerName: "payments",
+		Filename:   "/src/main.go",
+		Line:       42,
+		Baggage: map[string]interface{}{
+			"tenant":          "acme",
+			"attempt":         2,
+			TraceIDBaggageKey: "0af7651916cd43dd8448eb211c80319c",
+			SpanIDBaggageKey:  "b7ad6b7169203331",
+		},
+	})
+	require.NoError(t, h.Flush())
+
+	require.NotNil(t, req)
+	assert.Equal(t, "/v1/logs", req.URL.Path)
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				Scope      map[string]interface{}   `json:"scope"`
+				LogRecords []map[string]interface{} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	require.NoError(t, json.Unmarshal(body, &request))
+	require.Len(t, request.ResourceLogs, 1)
+	assert.Contains(t, request.ResourceLogs[0].Resource.Attributes, map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": "payments"},
+	})
+	assert.Contains(t, request.ResourceLogs[0].Resource.Attributes, map[string]interface{}{
+		"key": "process.executable.name", "value": map[string]interface{}{"stringValue": procName},
+	})
+	require.Len(t, request.ResourceLogs[0].ScopeLogs, 1)
+	scopeLogs := request.ResourceLogs[0].ScopeLogs[0]
+	assert.Equal(t, map[string]interface{}{"name": "payments"}, scopeLogs.Scope)
+	require.Len(t, scopeLogs.LogRecords, 1)
+	assert.Equal(t, map[string]interface{}{
+		"timeUnixNano":         "1528720518123456000",
+		"observedTimeUnixNano": "1528720518123456000",
+		"severityNumber":       17.0,
+		"severityText":         "ERROR",
+		"body":                 map[string]interface{}{"stringValue": "something failed"},
+		"traceId":              "0af7651916cd43dd8448eb211c80319c",
+		"spanId":               "b7ad6b7169203331",
+		"attributes": []interface{}{
+			map[string]interface{}{"key": "attempt", "value": map[string]interface{}{"intValue": "2"}},
+			map[string]interface{}{"key": "code.filepath", "value": map[string]interface{}{"stringValue": "/src/main.go"}},
+			map[string]interface{}{"key": "code.lineno", "value": map[string]interface{}{"intValue": "42"}},
+			map[string]interface{}{"key": "tenant", "value": map[string]interface{}{"stringValue": "acme"}},
+		},
+	}, scopeLogs.LogRecords[0])
+}
+
+func TestOTLPHandlerProtobuf(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	traceID := []byte{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c}
+	h, err := NewOTLPHandler(OTLPConfig{
+		Endpoint:      server.URL,
+		FlushInterval: time.Hour,
+		SpanContext: func(ctx context.Context) (string, string) {
+			return ctx.Value(otlpTestTraceKey{}).(string), "b7ad6b7169203331"
+		},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	ctx := context.WithValue(context.Background(), otlpTestTraceKey{}, "0af7651916cd43dd8448eb211c80319c")
+	h.Handle(&Record{
+		Level:      WARNING,
+		Time:       testRecordTime,
+		Message:    "something",
+		LoggerName: "payments",
+		Baggage:    map[string]interface{}{"ratio": 0.5, "retried": false},
+		Context:    ctx,
+	})
+	require.NoError(t, h.Flush())
+	assert.Equal(t, "application/x-protobuf", contentType)
+
+	resourceLogs := decodeProto(t, body)[1]
+	require.Len(t, resourceLogs, 1)
+	scopeLogs := decodeProto(t, resourceLogs[0].([]byte))[2]
+	require.Len(t, scopeLogs, 1)
+	scope := decodeProto(t, scopeLogs[0].([]byte))
+	assert.Equal(t, []interface{}{[]byte("payments")}, decodeProto(t, scope[1][0].([]byte))[1])
+	require.Len(t, scope[2], 1)
+
+	logRecord := decodeProto(t, scope[2][0].([]byte))
+	assert.Equal(t, []interface{}{uint64(testRecordTime.UnixNano())}, logRecord[1])
+	assert.Equal(t, []interface{}{uint64(13)}, logRecord[2])
+	assert.Equal(t, []interface{}{[]byte("WARNING")}, logRecord[3])
+	assert.Equal(t, map[int][]interface{}{1: {[]byte("something")}}, decodeProto(t, logRecord[5][0].([]byte)))
+	assert.Equal(t, []interface{}{traceID}, logRecord[9])
+	assert.Equal(t, []interface{}{[]byte{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31}}, logRecord[10])
+
+	require.Len(t, logRecord[6], 2)
+	ratio := decodeProto(t, logRecord[6][0].([]byte))
+	assert.Equal(t, []interface{}{[]byte("ratio")}, ratio[1])
+	assert.Equal(t, map[int][]interface{}{4: {math.Float64bits(0.5)}}, decodeProto(t, ratio[2][0].([]byte)))
+	retried := decodeProto(t, logRecord[6][1].([]byte))
+	assert.Equal(t, []interface{}{[]byte("retried")}, retried[1])
+	assert.Equal(t, map[int][]interface{}{2: {uint64(0)}}, decodeProto(t, retried[2][0].([]byte)))
+}
+
+func TestOTLPHandlerRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		requests int
+		failed   bool
+	}{
+		{"retries throttling and unavailability", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, 3, false},
+		{"gives up after max retries", []int{503, 503, 503}, 3, true},
+		{"doesn't retry other errors", []int{http.StatusInternalServerError}, 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []error
+			onHandlerError := OnHandlerError
+			OnHandlerError = func(err error) { errs = append(errs, err) }
+			defer func() { OnHandlerError = onHandlerError }()
+
+			var m sync.Mutex
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m.Lock()
+				defer m.Unlock()
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			h, err := NewOTLPHandler(OTLPConfig{
+				Endpoint:      server.URL,
+				FlushInterval: time.Hour,
+				MaxRetries:    2,
+				MinBackoff:    time.Millisecond,
+			})
+			require.NoError(t, err)
+			defer h.Close()
+
+			h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "something"})
+			require.NoError(t, h.Flush())
+
+			m.Lock()
+			defer m.Unlock()
+			assert.Equal(t, tc.requests, requests)
+			if tc.failed {
+				require.Len(t, errs, 1)
+				assert.Contains(t, errs[0].Error(), "can't export 1 records with OTLP")
+			} else {
+				assert.Empty(t, errs)
+			}
+		})
+	}
+}
+
+func TestOTLPHandlerCapsRetryAfter(t *testing.T) {
+	var m sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		if requests++; requests == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	h, err := NewOTLPHandler(OTLPConfig{Endpoint: server.URL, FlushInterval: time.Hour, MaxBackoff: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "something"})
+	require.NoError(t, h.Flush())
+
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(t, 2, requests)
+}
+
+func TestOTLPHandlerCloseDoesNotWaitToRetry(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	h, err := NewOTLPHandler(OTLPConfig{Endpoint: server.URL, FlushInterval: time.Hour, MinBackoff: time.Hour, MaxBackoff: time.Hour})
+	require.NoError(t, err)
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "something"})
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited to retry")
+	}
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "can't export 1 records with OTLP")
+}
+
+func TestBatcherDoesNotKeepRecordContexts(t *testing.T) {
+	var batches [][]*Record
+	b := newBatcher(10, time.Hour, func(batch []*Record) { batches = append(batches, batch) })
+
+	b.add(&Record{Message: "something", Context: context.Background()})
+	b.close()
+
+	require.Len(t, batches, 1)
+	assert.Nil(t, batches[0][0].Context)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Mon, 11 Jun 2018 12:35:18 GMT"))
+
+	wait := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, wait > 58*time.Second && wait <= time.Minute, "unexpected wait %s", wait)
+}
+
+type otlpTestTraceKey struct{}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// PanicError is the error logged when a panic is recovered, it carries the
+// recovered value and the stack of the goroutine that panicked.
+type PanicError struct {
+	Value interface{}
+	pcs   []uintptr
+}
+
+func newPanicError(value interface{}) *PanicError {
+	pcs := make([]uintptr, maxStackDepth)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	// Drop the frames of the deferred calls, so the stack starts where the panic happened.
+	for i, pc := range pcs {
+		if fn := runtime.FuncForPC(pc - 1); fn != nil && fn.Name() == "runtime.gopanic" {
+			pcs = pcs[i+1:]
+			break
+		}
+	}
+	return &PanicError{Value: value, pcs: pcs}
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// Callers returns the stack of the panic, implementing ErrorCallers.
+func (e *PanicError) Callers() []uintptr { return e.pcs }
+
+// Unwrap returns the recovered value if it's an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// RecoverAndLog recovers a panic and logs it at CRITICAL level through For(ctx),
+// with the panic value, its stack and the context baggage.
+// It has to be deferred directly: defer log.RecoverAndLog(ctx)
+func RecoverAndLog(ctx context.Context) {
+	if value := recover(); value != nil {
+		logPanic(ctx, value)
+	}
+}
+
+// RecoverLogAndRepanic is like RecoverAndLog but panics again with the recovered value once logged.
+// It has to be deferred directly: defer log.RecoverLogAndRepanic(ctx)
+func RecoverLogAndRepanic(ctx context.Context) {
+	if value := recover(); value != nil {
+		logPanic(ctx, value)
+		panic(value)
+	}
+}
+
+// Go runs fn in a new goroutine, recovering and logging any panic with RecoverAndLog,
+// so panics are attributed to the context that spawned the goroutine.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer RecoverAndLog(ctx)
+		fn(ctx)
+	}()
+}
+
+func logPanic(ctx context.Context, value interface{}) {
+	withError(For(ctx), newPanicError(value)).Criticalf("panic recovered: %v", value)
+}
@@ -0,0 +1,59 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoRecoversAndLogsPanics(t *testing.T) {
+	logged := make(chan *Record, 1)
+	installTestFactory(t, handlerFunc(func(rec *Record) { logged <- rec }))
+
+	ctx := WithBaggageValue(context.Background(), "request_id", "abc")
+	Go(ctx, func(ctx context.Context) {
+		panickingFunction()
+	})
+
+	rec := <-logged
+	assert.Equal(t, CRITICAL, rec.Level)
+	assert.Equal(t, "request_id:abc: panic recovered: boom", rec.Message)
+	require.Len(t, rec.Errors, 1)
+	assert.Equal(t, "*log.PanicError", rec.Errors[0].Type)
+	require.NotEmpty(t, rec.Errors[0].Stack)
+	assert.Equal(t, "github.com/cabify/go-logging.panickingFunction", rec.Errors[0].Stack[0].Function)
+}
+
+func TestRecoverLogAndRepanic(t *testing.T) {
+	var records []*Record
+	installTestFactory(t, handlerFunc(func(rec *Record) { records = append(records, rec) }))
+
+	assert.PanicsWithValue(t, "boom", func() {
+		defer RecoverLogAndRepanic(context.Background())
+		panickingFunction()
+	})
+	require.Len(t, records, 1)
+	assert.Equal(t, "panic recovered: boom", records[0].Message)
+}
+
+func TestPanicErrorUnwrapsErrorValues(t *testing.T) {
+	err := assert.AnError
+	assert.Equal(t, err, (&PanicError{Value: err}).Unwrap())
+	assert.Nil(t, (&PanicError{Value: "boom"}).Unwrap())
+}
+
+func panickingFunction() {
+	panic("boom")
+}
+
+// installTestFactory replaces DefaultFactory during the test with one of loggers emitting to handler.
+func installTestFactory(t *testing.T, handler Handler) {
+	l := NewLogger("test")
+	l.SetHandler(handler)
+
+	previous := DefaultFactory
+	DefaultFactory = Factory{baseLogger: l}
+	t.Cleanup(func() { DefaultFactory = previous })
+}
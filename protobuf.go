@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Protocol buffers wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// protoEncoder encodes protocol buffers messages field by field. Fields with
+// zero values are omitted, as proto3 does.
+type protoEncoder struct {
+	bytes.Buffer
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	e.Write(buf[:n])
+}
+
+func (e *protoEncoder) key(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *protoEncoder) uintField(field int, v uint64) {
+	if v != 0 {
+		e.key(field, protoVarint)
+		e.varint(v)
+	}
+}
+
+func (e *protoEncoder) intField(field int, v int64) {
+	e.uintField(field, uint64(v))
+}
+
+func (e *protoEncoder) boolField(field int, v bool) {
+	if v {
+		e.uintField(field, 1)
+	}
+}
+
+func (e *protoEncoder) fixed64(v uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	e.Write(buf[:])
+}
+
+func (e *protoEncoder) fixed64Field(field int, v uint64) {
+	if v != 0 {
+		e.key(field, protoFixed64)
+		e.fixed64(v)
+	}
+}
+
+func (e *protoEncoder) doubleField(field int, v float64) {
+	e.fixed64Field(field, math.Float64bits(v))
+}
+
+func (e *protoEncoder) bytesField(field int, b []byte) {
+	if len(b) > 0 {
+		e.key(field, protoBytes)
+		e.varint(uint64(len(b)))
+		e.Write(b)
+	}
+}
+
+func (e *protoEncoder) stringField(field int, s string) {
+	if s != "" {
+		e.key(field, protoBytes)
+		e.varint(uint64(len(s)))
+		e.WriteString(s)
+	}
+}
+
+// messageField encodes an embedded message, which is written even if empty.
+func (e *protoEncoder) messageField(field int, encode func(*protoEncoder)) {
+	msg := &protoEncoder{}
+	encode(msg)
+	e.key(field, protoBytes)
+	e.varint(uint64(msg.Len()))
+	e.Write(msg.Bytes())
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtoEncoder(t *testing.T) {
+	e := &protoEncoder{}
+	e.uintField(1, 300)
+	e.intField(2, 0)
+	e.stringField(3, "hi")
+	e.boolField(4, true)
+	e.doubleField(5, 1.5)
+	e.messageField(6, func(m *protoEncoder) { m.bytesField(1, []byte{7}) })
+	e.messageField(7, func(*protoEncoder) {})
+
+	fields := decodeProto(t, e.Bytes())
+	assert.Equal(t, map[int][]interface{}{
+		1: {uint64(300)},
+		3: {[]byte("hi")},
+		4: {uint64(1)},
+		5: {math.Float64bits(1.5)},
+		6: {[]byte{0x0a, 0x01, 0x07}},
+		7: {[]byte{}},
+	}, fields)
+}
+
+// decodeProto decodes the fields of a protocol buffers message by field number, as
+// uint64 values for varint and fixed64 fields and as []byte values for length delimited ones.
+func decodeProto(t *testing.T, data []byte) map[int][]interface{} {
+	fields := map[int][]interface{}{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		require.True(t, n > 0, "invalid field key")
+		data = data[n:]
+
+		var value interface{}
+		switch key & 7 {
+		case protoVarint:
+			v, n := binary.Uvarint(data)
+			require.True(t, n > 0, "invalid varint")
+			value, data = v, data[n:]
+		case protoFixed64:
+			require.True(t, len(data) >= 8, "invalid fixed64")
+			value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoBytes:
+			size, n := binary.Uvarint(data)
+			require.True(t, n > 0 && len(data) >= n+int(size), "invalid length delimited field")
+			value, data = append([]byte{}, data[n:n+int(size)]...), data[n+int(size):]
+		default:
+			t.Fatalf("unsupported wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
@@ -1,15 +1,64 @@
 package log
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Record contains all of the information about a single log message.
 type Record struct {
-	Message     string    // Formatted log message
-	LoggerName  string    // Name of the logger module
-	Level       Level     // Level of the record
-	Time        time.Time // Time of the record (local time)
-	Filename    string    // File name of the log call (absolute path)
-	Line        int       // Line number in file
-	ProcessID   int       // PID
-	ProcessName string    // Name of the process
+	Message       string                 // Formatted log message
+	LoggerName    string                 // Name of the logger module
+	Level         Level                  // Level of the record
+	Time          time.Time              // Time of the record, from the clock of the logger
+	Filename      string                 // File name of the log call (absolute path)
+	ShortFilename string                 // File name of the log call with its parent directory only
+	Line          int                    // Line number in file
+	Function      string                 // Function of the log call, package qualified
+	Package       string                 // Import path of the package of the log call
+	ProcessID     int                    // PID
+	ProcessName   string                 // Name of the process
+	Stack         Stack                  // Stack of the log call, if captured
+	Errors        []ErrorCause           // Chain of the error attached with Logger.WithError, outermost first
+	Baggage       map[string]interface{} // Baggage of the context of loggers obtained with For
+	Context       context.Context        // Context of loggers obtained with For, nil otherwise
+	Released      bool                   // Released by a request buffer below the level of its logger, see WithRequestBuffer
+}
+
+// recordFields returns the record as a flat map for structured outputs, with the baggage
+// keys next to the fields of the record. Baggage keys can't override the record fields.
+func recordFields(rec *Record) map[string]interface{} {
+	fields := map[string]interface{}{
+		"message": rec.Message,
+		"level":   LevelNames[rec.Level],
+		"logger":  rec.LoggerName,
+		"file":    rec.Filename,
+		"line":    rec.Line,
+		"process": rec.ProcessName,
+		"pid":     rec.ProcessID,
+	}
+	if rec.Function != "" {
+		fields["function"] = rec.Function
+	}
+	if len(rec.Stack) > 0 {
+		// Frames are maps so every encoder renders them like JSONFormatter does.
+		stack := make([]interface{}, len(rec.Stack))
+		for i, frame := range rec.Stack {
+			stack[i] = map[string]interface{}{"function": frame.Function, "file": frame.File, "line": frame.Line}
+		}
+		fields["stack"] = stack
+	}
+	if len(rec.Errors) > 0 {
+		errors := make([]interface{}, len(rec.Errors))
+		for i, cause := range rec.Errors {
+			errors[i] = cause.String()
+		}
+		fields["errors"] = errors
+	}
+	for key, value := range rec.Baggage {
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+	return fields
 }
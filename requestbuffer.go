@@ -0,0 +1,141 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultRequestBufferSize is the number of records held by request buffers created with a non positive size.
+const DefaultRequestBufferSize = 1000
+
+type requestBufferContextKey struct{}
+
+// WithRequestBuffer returns a context whose loggers obtained with For hold in memory the
+// records below their level, instead of discarding them. If the request logs an ERROR or
+// CRITICAL record, or it's marked as failed with MarkRequestFailed, the held records are
+// emitted, and so are the records logged afterwards, regardless of the level of loggers and
+// handlers. Only the last size records are held, DefaultRequestBufferSize if size is not positive.
+//
+// The returned function ends the scope of the request, releasing the held records. Loggers
+// filter records by their level as usual once it's called.
+func WithRequestBuffer(ctx context.Context, size int) (context.Context, func()) {
+	if size <= 0 {
+		size = DefaultRequestBufferSize
+	}
+	buffer := &requestBuffer{size: size}
+	return context.WithValue(ctx, requestBufferContextKey{}, buffer), buffer.end
+}
+
+// MarkRequestFailed emits the records held by the request buffer of the context, if any,
+// and makes its loggers emit the records logged afterwards regardless of their level.
+func MarkRequestFailed(ctx context.Context) {
+	if buffer := requestBufferFrom(ctx); buffer != nil {
+		buffer.fail()
+	}
+}
+
+func requestBufferFrom(ctx context.Context) *requestBuffer {
+	if ctx == nil {
+		return nil
+	}
+	buffer, _ := ctx.Value(requestBufferContextKey{}).(*requestBuffer)
+	return buffer
+}
+
+// requestBuffer holds the records of a request logged below the level of their loggers.
+type requestBuffer struct {
+	m       sync.Mutex
+	size    int
+	records []heldRecord
+	oldest  int
+	failed  bool
+	ended   bool
+}
+
+type heldRecord struct {
+	handler Handler
+	rec     *Record
+}
+
+// handle emits or holds a record logged by a logger with the given level and handler.
+// Records are emitted after releasing the lock, so slow handlers don't block the request.
+func (b *requestBuffer) handle(handler Handler, rec *Record, level Level) {
+	released, emit := b.add(handler, rec, level)
+	for _, held := range released {
+		held.handler.Handle(held.rec)
+	}
+	if emit {
+		handler.Handle(rec)
+	}
+}
+
+// add holds the record, or returns whether it must be emitted after the released records.
+func (b *requestBuffer) add(handler Handler, rec *Record, level Level) (released []heldRecord, emit bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch {
+	case b.ended:
+		return nil, rec.Level <= level
+	case b.failed:
+		rec.Released = rec.Level > level
+		return nil, true
+	case rec.Level <= ERROR:
+		return b.release(), true
+	case rec.Level <= level:
+		return nil, true
+	}
+
+	held := heldRecord{handler: handler, rec: rec}
+	if len(b.records) < b.size {
+		b.records = append(b.records, held)
+	} else {
+		b.records[b.oldest] = held
+		b.oldest = (b.oldest + 1) % b.size
+	}
+	return nil, false
+}
+
+func (b *requestBuffer) fail() {
+	b.m.Lock()
+	var released []heldRecord
+	if !b.ended {
+		released = b.release()
+	}
+	b.m.Unlock()
+
+	for _, held := range released {
+		held.handler.Handle(held.rec)
+	}
+}
+
+// release marks the request as failed and returns the held records to emit, oldest first.
+func (b *requestBuffer) release() []heldRecord {
+	b.failed = true
+	released := make([]heldRecord, 0, len(b.records))
+	for i := range b.records {
+		held := b.records[(b.oldest+i)%len(b.records)]
+		held.rec.Released = true
+		released = append(released, held)
+	}
+	b.records, b.oldest = nil, 0
+	return released
+}
+
+// active returns whether the buffer may hold or emit records below the level of their loggers,
+// which it does until the request ends. It's false for nil buffers.
+func (b *requestBuffer) active() bool {
+	if b == nil {
+		return false
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	return !b.ended
+}
+
+func (b *requestBuffer) end() {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.ended = true
+	b.records, b.oldest = nil, 0
+}
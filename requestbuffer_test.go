@@ -0,0 +1,138 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBufferReleasesRecordsOnError(t *testing.T) {
+	output := &bytes.Buffer{}
+	h := NewWriterHandler(output)
+	h.SetFormatter(messageFormatter{})
+	l := NewLogger("test")
+	l.SetHandler(h)
+
+	ctx, end := WithRequestBuffer(context.Background(), 0)
+	defer end()
+	log := Factory{baseLogger: l}.For(ctx)
+
+	log.Debug("debug 1")
+	log.Info("info")
+	log.Debugf("debug %d", 2)
+	assert.Equal(t, "info\n", output.String())
+
+	log.Error("error")
+	log.Debug("debug 3")
+	assert.Equal(t, "info\ndebug 1\ndebug 2\nerror\ndebug 3\n", output.String())
+}
+
+func TestRequestBufferDiscardsRecordsOfSuccessfulRequests(t *testing.T) {
+	var messages []string
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }))
+
+	ctx, end := WithRequestBuffer(context.Background(), 0)
+	log := Factory{baseLogger: l}.For(ctx)
+	log.Debug("discarded")
+	log.Warning("warning")
+	end()
+
+	log.Debug("after the request")
+	MarkRequestFailed(ctx)
+	log.Error("error")
+	assert.Equal(t, []string{"warning", "error"}, messages)
+}
+
+func TestRequestBufferMarkedAsFailedKeepsLastRecords(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+
+	ctx, end := WithRequestBuffer(context.Background(), 2)
+	defer end()
+	log := Factory{baseLogger: l}.For(ctx)
+	log.Debug("dropped")
+	log.Debug("debug 1")
+	log.Info("info")
+	log.Debug("debug 2")
+
+	MarkRequestFailed(ctx)
+	var messages []string
+	for _, rec := range records {
+		messages = append(messages, rec.Message)
+	}
+	assert.Equal(t, []string{"info", "debug 1", "debug 2"}, messages)
+	assert.False(t, records[0].Released)
+	assert.True(t, records[1].Released)
+}
+
+func TestRequestBufferDoesNotFormatRecordsAfterTheRequestEnds(t *testing.T) {
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(*Record) {}))
+	ctx, end := WithRequestBuffer(context.Background(), 0)
+
+	formatted := 0
+	arg := stringerFunc(func() string { formatted++; return "arg" })
+	for _, base := range []Logger{l, NoDebugLogger{Logger: l}} {
+		Factory{baseLogger: base}.For(ctx).Debug(arg)
+	}
+	assert.Equal(t, 2, formatted, "records are held while the request runs")
+
+	end()
+	for _, base := range []Logger{l, NoDebugLogger{Logger: l}} {
+		Factory{baseLogger: base}.For(ctx).Debug(arg)
+	}
+	assert.Equal(t, 2, formatted, "records below the level are discarded without formatting once the request ends")
+}
+
+type stringerFunc func() string
+
+func (f stringerFunc) String() string { return f() }
+
+func TestRequestBufferEmitsWithoutHoldingTheLock(t *testing.T) {
+	ctx, end := WithRequestBuffer(context.Background(), 0)
+	defer end()
+
+	var messages []string
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) {
+		messages = append(messages, rec.Message)
+		// Handlers logging to the same request would deadlock if the lock was held.
+		MarkRequestFailed(ctx)
+	}))
+	log := Factory{baseLogger: l}.For(ctx)
+	log.Debug("debug")
+	log.Error("error")
+	assert.Equal(t, []string{"debug", "error"}, messages)
+}
+
+func TestRequestBufferReleasedRecordsAreFilteredByAlertingHandlers(t *testing.T) {
+	h := NewBaseHandler()
+	h.SetLevel(ERROR)
+	released := &Record{Level: DEBUG, Released: true}
+	assert.True(t, h.Filter(released))
+
+	h.FilterReleased = true
+	assert.False(t, h.Filter(released))
+	assert.True(t, h.Filter(&Record{Level: ERROR, Released: true}))
+}
+
+func TestRequestBufferHoldsDebugRecordsOfNoDebugLogger(t *testing.T) {
+	var messages []string
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }))
+
+	ctx, end := WithRequestBuffer(context.Background(), 0)
+	defer end()
+	log := Factory{baseLogger: NoDebugLogger{Logger: l}}.For(ctx)
+	log.Debug("debug")
+	log.(ErrorLogger).WithError(assert.AnError).Critical("critical")
+	assert.Equal(t, []string{"debug", "critical"}, messages)
+
+	messages = nil
+	Factory{baseLogger: NoDebugLogger{Logger: l}}.For(context.Background()).Debug("discarded")
+	assert.Empty(t, messages)
+}
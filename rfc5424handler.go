@@ -0,0 +1,251 @@
+package log
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facility is the syslog facility of the messages sent by RFC5424Handler.
+type Facility int
+
+// Syslog facilities. The zero value of Facility isn't a facility, so RFC5424Config
+// can tell when it's not set.
+const (
+	FacilityKern Facility = iota + 1
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityNTP
+	FacilitySecurity
+	FacilityConsole
+	FacilitySolarisCron
+	FacilityLocal0
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// code returns the numerical code of the facility in syslog messages.
+func (f Facility) code() int {
+	return int(f - FacilityKern)
+}
+
+// SyslogFraming is the framing of syslog messages sent over stream transports, as defined by RFC 6587.
+type SyslogFraming int
+
+// Syslog framings.
+const (
+	// OctetCounting prefixes each message with its length and a space.
+	OctetCounting SyslogFraming = iota
+	// NonTransparentFraming terminates each message with a line feed.
+	NonTransparentFraming
+)
+
+// rfc5424TimeLayout is the layout of RFC 5424 timestamps, with microseconds precision.
+const rfc5424TimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// DefaultStructuredDataID is the SD-ID of the structured data element containing the baggage.
+const DefaultStructuredDataID = "baggage@32473"
+
+// syslogSeverities maps levels to syslog severities.
+var syslogSeverities = map[Level]int{
+	CRITICAL: 2,
+	ERROR:    3,
+	WARNING:  4,
+	NOTICE:   5,
+	INFO:     6,
+	DEBUG:    7,
+}
+
+// RFC5424Config configures a RFC5424Handler.
+type RFC5424Config struct {
+	// Network is "udp", "tcp" or "tls".
+	Network string
+	// Address of the syslog server, like "localhost:514".
+	Address string
+	// TLSConfig is the configuration of "tls" connections.
+	TLSConfig *tls.Config
+	// Framing of the messages on "tcp" and "tls" connections, OctetCounting by default.
+	Framing SyslogFraming
+	// Facility of the messages, FacilityUser by default.
+	Facility Facility
+	// Hostname of the messages, os.Hostname() by default.
+	Hostname string
+	// AppName of the messages, the process name by default.
+	AppName string
+	// MsgID of the messages, none by default.
+	MsgID string
+	// StructuredDataID is the SD-ID of the element containing the record baggage,
+	// DefaultStructuredDataID by default.
+	StructuredDataID string
+	// DialTimeout is the timeout of each dial, DefaultNetDialTimeout by default.
+	DialTimeout time.Duration
+	// WriteTimeout is the deadline of each write, DefaultNetWriteTimeout by default.
+	WriteTimeout time.Duration
+}
+
+// RFC5424Handler sends the logging output to a syslog server using the RFC 5424 protocol,
+// with the record baggage as STRUCTURED-DATA. Connections are dialed again after network errors,
+// with exponential backoff, and records are dropped while waiting to dial.
+type RFC5424Handler struct {
+	*BaseHandler
+	cfg  RFC5424Config
+	conn *reconnectingConn
+}
+
+// NewRFC5424Handler returns a RFC5424Handler connected to the configured syslog server.
+func NewRFC5424Handler(cfg RFC5424Config) (*RFC5424Handler, error) {
+	if cfg.Facility == 0 {
+		cfg.Facility = FacilityUser
+	}
+	if cfg.Facility < FacilityKern || cfg.Facility > FacilityLocal7 {
+		return nil, fmt.Errorf("unknown syslog facility %d", cfg.Facility)
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = procName
+	}
+	if cfg.StructuredDataID == "" {
+		cfg.StructuredDataID = DefaultStructuredDataID
+	}
+
+	conn := connConfig{
+		Network:      cfg.Network,
+		Address:      cfg.Address,
+		DialTimeout:  cfg.DialTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+	switch cfg.Network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	case "tls":
+		conn.Network = "tcp"
+		conn.TLSConfig = cfg.TLSConfig
+		if conn.TLSConfig == nil {
+			conn.TLSConfig = &tls.Config{}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", cfg.Network)
+	}
+
+	c, err := dialReconnecting(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &RFC5424Handler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		conn:        c,
+	}, nil
+}
+
+func (h *RFC5424Handler) Handle(rec *Record) {
+	message := h.BaseHandler.FilterAndFormat(rec)
+	if message == "" {
+		return
+	}
+
+	frame := h.format(rec, strings.TrimSuffix(message, "\n"))
+	if !strings.HasPrefix(h.cfg.Network, "udp") {
+		if h.cfg.Framing == NonTransparentFraming {
+			frame = frame + "\n"
+		} else {
+			frame = strconv.Itoa(len(frame)) + " " + frame
+		}
+	}
+
+	if _, err := h.conn.Write([]byte(frame)); err != nil {
+		OnHandlerError(fmt.Errorf("can't send syslog message: %v", err))
+	}
+}
+
+// format returns the RFC 5424 message for the record.
+func (h *RFC5424Handler) format(rec *Record, message string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		h.cfg.Facility.code()*8+syslogSeverities[rec.Level],
+		rec.Time.Format(rfc5424TimeLayout),
+		syslogHeaderField(h.cfg.Hostname, 255),
+		syslogHeaderField(h.cfg.AppName, 48),
+		rec.ProcessID,
+		syslogHeaderField(h.cfg.MsgID, 32),
+		h.structuredData(rec.Baggage),
+		message,
+	)
+}
+
+// structuredData returns the STRUCTURED-DATA element with the baggage, or the nil value "-".
+func (h *RFC5424Handler) structuredData(baggage map[string]interface{}) string {
+	if len(baggage) == 0 {
+		return "-"
+	}
+
+	keys := make([]string, 0, len(baggage))
+	for key := range baggage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	b := strings.Builder{}
+	b.WriteString("[")
+	b.WriteString(h.cfg.StructuredDataID)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=\"%s\"", syslogParamName(key), syslogParamValue(fmt.Sprint(baggage[key])))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func (h *RFC5424Handler) Close() error {
+	return h.conn.Close()
+}
+
+// syslogHeaderField returns the value as a header field of at most maxLen printable
+// characters, or the nil value "-" if empty.
+func syslogHeaderField(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// syslogParamName returns the key as a valid SD-NAME.
+func syslogParamName(key string) string {
+	return syslogHeaderField(strings.Map(func(r rune) rune {
+		if r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key), 32)
+}
+
+// syslogParamValue escapes the characters that can't appear in a PARAM-VALUE.
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
@@ -0,0 +1,239 @@
+package log
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecordTime = time.Date(2018, 6, 11, 12, 35, 18, 123456000, time.UTC)
+
+func TestRFC5424HandlerFormat(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h, err := NewRFC5424Handler(RFC5424Config{
+		Network:  "udp",
+		Address:  listener.LocalAddr().String(),
+		Facility: FacilityLocal0,
+		Hostname: "my host",
+		AppName:  "app",
+		MsgID:    "ID42",
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{
+		Level:     ERROR,
+		Time:      testRecordTime,
+		Message:   "something failed\n",
+		ProcessID: 1234,
+		Baggage:   map[string]interface{}{"tenant": "acme", "weird key=": `a "quoted] \value`},
+	})
+	h.Handle(&Record{Level: INFO, Time: testRecordTime, Message: "no baggage", ProcessID: 1234})
+
+	buf := make([]byte, 1024)
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `<131>1 2018-06-11T12:35:18.123456Z my_host app 1234 ID42 [baggage@32473 tenant="acme" weird_key_="a \"quoted\] \\value"] something failed`, string(buf[:n]))
+
+	n, _, err = listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, `<134>1 2018-06-11T12:35:18.123456Z my_host app 1234 ID42 - no baggage`, string(buf[:n]))
+}
+
+func TestRFC5424HandlerKernFacility(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h, err := NewRFC5424Handler(RFC5424Config{Network: "udp", Address: listener.LocalAddr().String(), Facility: FacilityKern})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Time: testRecordTime, Message: "kernel"})
+
+	buf := make([]byte, 1024)
+	n, _, err := listener.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(buf[:n]), "<3>1 "))
+
+	_, err = NewRFC5424Handler(RFC5424Config{Network: "udp", Address: listener.LocalAddr().String(), Facility: FacilityLocal7 + 1})
+	assert.Error(t, err)
+}
+
+func TestRFC5424HandlerFramings(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+
+	for _, tc := range []struct {
+		name    string
+		network string
+		framing SyslogFraming
+		listen  func() (net.Listener, error)
+	}{
+		{
+			name:    "tcp with octet counting",
+			network: "tcp",
+			framing: OctetCounting,
+			listen:  func() (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") },
+		},
+		{
+			name:    "tcp with non transparent framing",
+			network: "tcp",
+			framing: NonTransparentFraming,
+			listen:  func() (net.Listener, error) { return net.Listen("tcp", "127.0.0.1:0") },
+		},
+		{
+			name:    "tls with octet counting",
+			network: "tls",
+			framing: OctetCounting,
+			listen:  func() (net.Listener, error) { return tls.Listen("tcp", "127.0.0.1:0", serverTLS) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			listener, err := tc.listen()
+			require.NoError(t, err)
+			defer listener.Close()
+			messages := acceptSyslogMessages(t, listener, tc.framing)
+
+			h, err := NewRFC5424Handler(RFC5424Config{
+				Network:   tc.network,
+				Address:   listener.Addr().String(),
+				TLSConfig: clientTLS,
+				Framing:   tc.framing,
+				Hostname:  "host",
+				AppName:   "app",
+			})
+			require.NoError(t, err)
+			defer h.Close()
+			h.SetFormatter(messageFormatter{})
+
+			h.Handle(&Record{Level: WARNING, Time: testRecordTime, Message: "first", ProcessID: 1})
+			h.Handle(&Record{Level: WARNING, Time: testRecordTime, Message: "second", ProcessID: 1})
+
+			assert.Equal(t, "<12>1 2018-06-11T12:35:18.123456Z host app 1 - - first", <-messages)
+			assert.Equal(t, "<12>1 2018-06-11T12:35:18.123456Z host app 1 - - second", <-messages)
+		})
+	}
+}
+
+func TestRFC5424HandlerReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	h, err := NewRFC5424Handler(RFC5424Config{Network: "tcp", Address: listener.Addr().String()})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	first, err := listener.Accept()
+	require.NoError(t, err)
+	first.Close()
+
+	messages := acceptSyslogMessages(t, listener, OctetCounting)
+	deadline := time.After(5 * time.Second)
+	for {
+		h.Handle(&Record{Level: INFO, Time: testRecordTime, Message: "after reconnecting"})
+		select {
+		case message := <-messages:
+			assert.True(t, strings.HasSuffix(message, "after reconnecting"))
+			return
+		case <-deadline:
+			t.Fatal("handler didn't reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// acceptSyslogMessages accepts a connection and sends the framed messages received to the returned channel.
+func acceptSyslogMessages(t *testing.T, listener net.Listener, framing SyslogFraming) <-chan string {
+	messages := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var message string
+			if framing == NonTransparentFraming {
+				message, err = r.ReadString('\n')
+				message = strings.TrimSuffix(message, "\n")
+			} else {
+				message, err = readOctetCounted(r)
+			}
+			if err != nil {
+				return
+			}
+			messages <- message
+		}
+	}()
+	return messages
+}
+
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, n)
+	_, err = io.ReadFull(r, message)
+	return string(message), err
+}
+
+// newTestTLSConfigs returns the TLS configurations of a server with a self signed certificate
+// for 127.0.0.1 and a client trusting it.
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	certificate := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+	server = &tls.Config{Certificates: []tls.Certificate{certificate}, ClientCAs: pool}
+	client = &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{certificate}}
+	return server, client
+}
+
+type messageFormatter struct{}
+
+func (messageFormatter) Format(rec *Record) string { return rec.Message }
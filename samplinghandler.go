@@ -0,0 +1,40 @@
+package log
+
+import "sync"
+
+// SamplingHandler decorates a handler emitting one of every n records of each level, the
+// first one included, to reduce the volume of noisy outputs. ERROR and CRITICAL records
+// are always emitted.
+type SamplingHandler struct {
+	Handler
+	n int
+
+	m      sync.Mutex
+	counts map[Level]int
+}
+
+// NewSamplingHandler returns a SamplingHandler emitting one of every n records, all of them if n is lower than 2.
+func NewSamplingHandler(handler Handler, n int) *SamplingHandler {
+	return &SamplingHandler{Handler: handler, n: n, counts: map[Level]int{}}
+}
+
+func (h *SamplingHandler) Handle(rec *Record) {
+	if rec.Level > ERROR && h.n > 1 {
+		h.m.Lock()
+		count := h.counts[rec.Level]
+		h.counts[rec.Level] = (count + 1) % h.n
+		h.m.Unlock()
+		if count != 0 {
+			return
+		}
+	}
+	h.Handler.Handle(rec)
+}
+
+// Flush flushes the decorated handler if it implements Flusher.
+func (h *SamplingHandler) Flush() error {
+	if flusher, ok := h.Handler.(Flusher); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
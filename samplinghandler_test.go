@@ -0,0 +1,20 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	var messages []string
+	h := NewSamplingHandler(handlerFunc(func(rec *Record) { messages = append(messages, rec.Message) }), 3)
+
+	for _, message := range []string{"info 1", "info 2", "info 3", "info 4"} {
+		h.Handle(&Record{Level: INFO, Message: message})
+	}
+	h.Handle(&Record{Level: DEBUG, Message: "debug 1"})
+	h.Handle(&Record{Level: ERROR, Message: "error 1"})
+	h.Handle(&Record{Level: ERROR, Message: "error 2"})
+	assert.Equal(t, []string{"info 1", "info 4", "debug 1", "error 1", "error 2"}, messages)
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var (
+	// ExitFunc terminates the process once Exit has shut down the handlers, it can be replaced in tests.
+	ExitFunc = os.Exit
+	// ShutdownTimeout is the maximum time Exit waits for exit hooks and handlers to finish.
+	ShutdownTimeout = 5 * time.Second
+)
+
+// ErrShutdownTimeout is returned by Shutdown when the handlers are not closed in time.
+var ErrShutdownTimeout = errors.New("timed out closing log handlers")
+
+var registry struct {
+	sync.Mutex
+	handlers []Handler
+	hooks    []func()
+}
+
+// RegisterHandler registers a handler to be closed by Shutdown, along with DefaultHandler.
+func RegisterHandler(h Handler) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.handlers = append(registry.handlers, h)
+}
+
+// replaceRegisteredHandler registers h in place of old, or appends it if old isn't registered,
+// so reconfiguring the default logger doesn't grow the registry.
+func replaceRegisteredHandler(old, h Handler) {
+	registry.Lock()
+	defer registry.Unlock()
+	for i, other := range registry.handlers {
+		if old != nil && sameHandler(other, old) {
+			registry.handlers[i] = h
+			return
+		}
+	}
+	registry.handlers = append(registry.handlers, h)
+}
+
+// RegisterExitHook registers a function to be run by Exit before the handlers are closed.
+// Hooks run in registration order.
+func RegisterExitHook(fn func()) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.hooks = append(registry.hooks, fn)
+}
+
+// Shutdown flushes and closes the handler of DefaultLogger, DefaultHandler and the registered
+// handlers concurrently, returning ErrShutdownTimeout if they don't finish before the given timeout.
+// Handlers still closing then keep running in the background, and a later Shutdown or Exit
+// waits for them before closing the handlers again.
+func Shutdown(timeout time.Duration) error {
+	return withTimeout(timeout, ErrShutdownTimeout, closeHandlers)
+}
+
+// Exit runs the exit hooks, flushes and closes the handlers like Shutdown,
+// and then calls ExitFunc with the given code.
+// Hooks and handlers are given ShutdownTimeout to finish.
+func Exit(code int) {
+	_ = withTimeout(ShutdownTimeout, ErrShutdownTimeout, func() error {
+		runExitHooks()
+		return closeHandlers()
+	})
+	ExitFunc(code)
+}
+
+// withTimeout runs fn, returning its error, or timeoutErr if it doesn't finish before the given timeout.
+// fn can't be interrupted, so it leaks and keeps running in the background after timing out.
+func withTimeout(timeout time.Duration, timeoutErr error, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return timeoutErr
+	}
+}
+
+func runExitHooks() {
+	registry.Lock()
+	hooks := append([]func(){}, registry.hooks...)
+	registry.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// closing is held while closing the handlers, so closes that outlived the timeout of a
+// Shutdown don't race with the ones of a later Shutdown or Exit.
+var closing sync.Mutex
+
+func closeHandlers() error {
+	closing.Lock()
+	defer closing.Unlock()
+	handlers := registeredHandlers()
+
+	var result error
+	var m sync.Mutex
+	wg := sync.WaitGroup{}
+	wg.Add(len(handlers))
+	for _, handler := range handlers {
+		go func(handler Handler) {
+			var err error
+			if flusher, ok := handler.(Flusher); ok {
+				err = flusher.Flush()
+			}
+			m.Lock()
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+			m.Unlock()
+
+			err = handler.Close()
+			m.Lock()
+			if err != nil {
+				result = multierror.Append(result, err)
+			}
+			m.Unlock()
+			wg.Done()
+		}(handler)
+	}
+	wg.Wait()
+	return result
+}
+
+// registeredHandlers returns the handler of DefaultLogger, DefaultHandler and the registered handlers,
+// without duplicates.
+func registeredHandlers() []Handler {
+	registry.Lock()
+	defer registry.Unlock()
+
+	var handlers []Handler
+	for _, h := range append([]Handler{LoggerHandler(DefaultLogger), DefaultHandler}, registry.handlers...) {
+		if h != nil && !containsHandler(handlers, h) {
+			handlers = append(handlers, h)
+		}
+	}
+	return handlers
+}
+
+func containsHandler(handlers []Handler, h Handler) bool {
+	for _, other := range handlers {
+		if sameHandler(other, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHandler returns whether both handlers are the same one, without panicking on handlers of
+// non comparable types, which are never considered the same.
+func sameHandler(a, b Handler) bool {
+	return reflect.TypeOf(a).Comparable() && reflect.TypeOf(a) == reflect.TypeOf(b) && a == b
+}
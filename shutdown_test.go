@@ -0,0 +1,143 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closeRecorder struct {
+	handlerFunc
+	closed chan struct{}
+}
+
+func newCloseRecorder() *closeRecorder {
+	return &closeRecorder{handlerFunc: func(*Record) {}, closed: make(chan struct{})}
+}
+
+func (h *closeRecorder) Close() error {
+	close(h.closed)
+	return nil
+}
+
+func TestFatalClosesHandlersAndExits(t *testing.T) {
+	defer restoreShutdownState()()
+
+	var steps []string
+	handler := newCloseRecorder()
+	DefaultHandler = handler
+	RegisterExitHook(func() { steps = append(steps, "hook") })
+	ExitFunc = func(code int) {
+		select {
+		case <-handler.closed:
+			steps = append(steps, "closed")
+		default:
+		}
+		steps = append(steps, "exit")
+		assert.Equal(t, 1, code)
+	}
+
+	l := NewLogger("test")
+	l.SetHandler(handler)
+	l.Fatalf("bye %s", "world")
+
+	assert.Equal(t, []string{"hook", "closed", "exit"}, steps)
+}
+
+func TestShutdownTimesOut(t *testing.T) {
+	defer restoreShutdownState()()
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+	DefaultHandler = &blockingCloseHandler{blocked: blocked}
+
+	assert.Equal(t, ErrShutdownTimeout, Shutdown(10*time.Millisecond))
+}
+
+func TestShutdownWaitsForTheClosesOfTimedOutShutdowns(t *testing.T) {
+	defer restoreShutdownState()()
+
+	blocked := make(chan struct{})
+	handler := &blockingCloseHandler{blocked: blocked}
+	DefaultHandler = handler
+
+	assert.Equal(t, ErrShutdownTimeout, Shutdown(10*time.Millisecond))
+	assert.Equal(t, ErrShutdownTimeout, Shutdown(10*time.Millisecond))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&handler.closes), "handlers are not closed concurrently")
+
+	close(blocked)
+	assert.NoError(t, Shutdown(time.Second))
+}
+
+func TestShutdownClosesRegisteredHandlersOnce(t *testing.T) {
+	defer restoreShutdownState()()
+
+	handler := newCloseRecorder()
+	DefaultHandler = handler
+	RegisterHandler(handler)
+
+	assert.NoError(t, Shutdown(time.Second))
+}
+
+func TestFileHandlerCloseClosesTheFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "filehandler")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	require.NoError(t, NewFileHandler(f).Close())
+	_, err = f.WriteString("closed")
+	assert.Error(t, err)
+}
+
+func TestFileHandlerCloseKeepsStandardOutputsOpen(t *testing.T) {
+	require.NoError(t, NewFileHandler(os.Stdout).Close())
+	require.NoError(t, NewFileHandler(os.Stderr).Close())
+
+	_, err := os.Stderr.WriteString("")
+	assert.NoError(t, err)
+	_, err = os.Stdout.Stat()
+	assert.NoError(t, err)
+}
+
+func TestConfigureDefaultLoggerReplacesItsRegisteredHandler(t *testing.T) {
+	defer restoreShutdownState()()
+	defer func(level Level) { DefaultLevel = level }(DefaultLevel)
+	DefaultLogger, DefaultHandler = NewLogger("test"), newCloseRecorder()
+
+	ConfigureDefaultLogger("test", Config{Level: "error", Output: "stdout"})
+	registered := len(registry.handlers)
+	ConfigureDefaultLogger("test", Config{Level: "error", Output: "stdout"})
+
+	assert.Len(t, registry.handlers, registered)
+	assert.True(t, containsHandler(registry.handlers, LoggerHandler(DefaultLogger)))
+}
+
+type blockingCloseHandler struct {
+	handlerFunc
+	blocked chan struct{}
+	closes  int32
+}
+
+func (h *blockingCloseHandler) Close() error {
+	atomic.AddInt32(&h.closes, 1)
+	<-h.blocked
+	return nil
+}
+
+// restoreShutdownState returns a function restoring the state changed by shutdown tests.
+func restoreShutdownState() func() {
+	defaultLogger, handler, exit, configured := DefaultLogger, DefaultHandler, ExitFunc, configuredHandler
+	factory, handlers, hooks := DefaultFactory, registry.handlers, registry.hooks
+	return func() {
+		registry.Lock()
+		defer registry.Unlock()
+		DefaultLogger, DefaultHandler, ExitFunc, configuredHandler = defaultLogger, handler, exit, configured
+		DefaultFactory = factory
+		registry.handlers, registry.hooks = handlers, hooks
+	}
+}
@@ -0,0 +1,328 @@
+package log
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPAuth is the authentication mechanism used by SMTPHandler.
+type SMTPAuth int
+
+// SMTP authentication mechanisms.
+const (
+	SMTPAuthPlain SMTPAuth = iota
+	SMTPAuthLogin
+)
+
+// Defaults of SMTPConfig.
+const (
+	DefaultSMTPQuietPeriod = time.Minute
+	DefaultSMTPMaxDelay    = 10 * time.Minute
+	DefaultSMTPMaxRecords  = 100
+	DefaultSMTPTimeout     = 30 * time.Second
+)
+
+// SMTPConfig configures an SMTPHandler.
+type SMTPConfig struct {
+	// Address of the SMTP server, like "smtp.example.com:587".
+	Address string
+	// Username and Password authenticate with the server if Username is not empty.
+	Username string
+	Password string
+	// Auth is the authentication mechanism, SMTPAuthPlain by default.
+	Auth SMTPAuth
+	// TLSConfig is used with STARTTLS, which is used when the server supports it.
+	// The server name is taken from Address if not set.
+	TLSConfig *tls.Config
+	// RequireTLS fails sending digests if the server doesn't support STARTTLS.
+	RequireTLS bool
+	// From is the sender address of the digests.
+	From string
+	// To are the recipient addresses of the digests.
+	To []string
+	// Subject of the digests, "<process name>: N records logged" by default.
+	Subject string
+	// QuietPeriod is the time without new records after which a digest is sent, DefaultSMTPQuietPeriod by default.
+	QuietPeriod time.Duration
+	// MaxDelay is the maximum time a record waits to be sent, DefaultSMTPMaxDelay by default.
+	MaxDelay time.Duration
+	// MaxRecords is the maximum number of records of a digest, others are only counted.
+	// DefaultSMTPMaxRecords by default.
+	MaxRecords int
+	// Timeout is the maximum time to connect to the server and send a digest, DefaultSMTPTimeout by default.
+	Timeout time.Duration
+}
+
+// SMTPHandler sends the logging output in email digests. Only ERROR and CRITICAL records are
+// sent by default. A digest is sent when no records are logged for a quiet period, or after a
+// maximum delay since its first record, and the pending digest is sent on Close. Each record is
+// followed by its caller and baggage. Errors sending digests are reported with OnHandlerError.
+type SMTPHandler struct {
+	*BaseHandler
+	cfg  SMTPConfig
+	host string
+
+	m       sync.Mutex
+	send    sync.Mutex
+	pending []*Record
+	omitted int
+	first   time.Time
+	timer   *time.Timer
+	closed  bool
+}
+
+// NewSMTPHandler returns an SMTPHandler sending digests through the configured server.
+func NewSMTPHandler(cfg SMTPConfig) (*SMTPHandler, error) {
+	host, _, err := net.SplitHostPort(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address: %v", err)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("SMTP sender and recipients are required")
+	}
+	// Line breaks would inject headers in the digests.
+	for _, header := range append([]string{cfg.From, cfg.Subject}, cfg.To...) {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("invalid SMTP header %q: line breaks are not allowed", header)
+		}
+	}
+	if cfg.QuietPeriod <= 0 {
+		cfg.QuietPeriod = DefaultSMTPQuietPeriod
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = DefaultSMTPMaxDelay
+	}
+	if cfg.MaxRecords <= 0 {
+		cfg.MaxRecords = DefaultSMTPMaxRecords
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSMTPTimeout
+	}
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{}
+	}
+	if cfg.TLSConfig.ServerName == "" {
+		cfg.TLSConfig = cfg.TLSConfig.Clone()
+		cfg.TLSConfig.ServerName = host
+	}
+
+	h := &SMTPHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		host:        host,
+	}
+	h.SetLevel(ERROR)
+	// Records released by request buffers below the level are not sent.
+	h.FilterReleased = true
+	return h, nil
+}
+
+func (h *SMTPHandler) Handle(rec *Record) {
+	if !h.Filter(rec) {
+		return
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.closed {
+		return
+	}
+
+	now := time.Now()
+	if len(h.pending) == 0 && h.omitted == 0 {
+		h.first = now
+	}
+	if len(h.pending) < h.cfg.MaxRecords {
+		h.pending = append(h.pending, rec)
+	} else {
+		h.omitted++
+	}
+
+	wait := h.cfg.QuietPeriod
+	if remaining := h.first.Add(h.cfg.MaxDelay).Sub(now); remaining < wait {
+		wait = remaining
+	}
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.timer = time.AfterFunc(wait, func() { _ = h.sendDigest() })
+}
+
+// Flush sends the pending digest.
+func (h *SMTPHandler) Flush() error {
+	return h.sendDigest()
+}
+
+// Close sends the pending digest.
+func (h *SMTPHandler) Close() error {
+	h.m.Lock()
+	h.closed = true
+	h.m.Unlock()
+	return h.sendDigest()
+}
+
+// sendDigest sends the pending records in a digest, reporting errors with OnHandlerError.
+func (h *SMTPHandler) sendDigest() error {
+	// Digests are sent one at a time, so they arrive in order.
+	h.send.Lock()
+	defer h.send.Unlock()
+
+	h.m.Lock()
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	records, omitted := h.pending, h.omitted
+	h.pending, h.omitted = nil, 0
+	h.m.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := h.sendMail(h.digest(records, omitted)); err != nil {
+		err = fmt.Errorf("can't send digest of %d records: %v", len(records)+omitted, err)
+		OnHandlerError(err)
+		return err
+	}
+	return nil
+}
+
+// digest returns the message of the digest, with its headers.
+func (h *SMTPHandler) digest(records []*Record, omitted int) []byte {
+	total := len(records) + omitted
+	subject := h.cfg.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("%s: %d records logged", procName, total)
+	}
+
+	// Headers end with CRLF, as RFC 5322 requires, and the subject may not be ASCII.
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "From: %s\r\n", h.cfg.From)
+	fmt.Fprintf(b, "To: %s\r\n", strings.Join(h.cfg.To, ", "))
+	fmt.Fprintf(b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(b, "%d records logged by %s:\n", total, procName)
+	for _, rec := range records {
+		b.WriteString("\n")
+		b.WriteString(strings.TrimSuffix(h.Formatter.Format(rec), "\n"))
+		b.WriteString("\n")
+		if rec.Function != "" {
+			fmt.Fprintf(b, "\tcaller: %s (%s:%d)\n", rec.Function, rec.Filename, rec.Line)
+		} else {
+			fmt.Fprintf(b, "\tcaller: %s:%d\n", rec.Filename, rec.Line)
+		}
+
+		keys := make([]string, 0, len(rec.Baggage))
+		for key := range rec.Baggage {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(b, "\t%s: %v\n", key, rec.Baggage[key])
+		}
+	}
+	if omitted > 0 {
+		fmt.Fprintf(b, "\n%d more records omitted\n", omitted)
+	}
+	return b.Bytes()
+}
+
+func (h *SMTPHandler) sendMail(message []byte) error {
+	conn, err := (&net.Dialer{Timeout: h.cfg.Timeout}).Dial("tcp", h.cfg.Address)
+	if err != nil {
+		return err
+	}
+	// The deadline covers the whole conversation, so a stalled server can't block the digests.
+	if err := conn.SetDeadline(time.Now().Add(h.cfg.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, h.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(h.cfg.TLSConfig); err != nil {
+			return err
+		}
+	} else if h.cfg.RequireTLS {
+		return errors.New("server doesn't support STARTTLS")
+	}
+
+	if h.cfg.Username != "" {
+		var auth smtp.Auth
+		if h.cfg.Auth == SMTPAuthLogin {
+			auth = &loginAuth{username: h.cfg.Username, password: h.cfg.Password, host: h.host}
+		} else {
+			auth = smtp.PlainAuth("", h.cfg.Username, h.cfg.Password, h.host)
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(h.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range h.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which like smtp.PlainAuth
+// only sends the credentials over TLS connections or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+	}
+}
@@ -0,0 +1,308 @@
+package log
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type smtpMail struct {
+	auth []string
+	tls  bool
+	from string
+	to   []string
+	data string
+}
+
+func TestSMTPHandlerSendsDigestAfterQuietPeriod(t *testing.T) {
+	addr, mails := startSMTPStub(t, nil)
+
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     addr,
+		Username:    "user",
+		Password:    "secret",
+		From:        "app@example.com",
+		To:          []string{"ops@example.com", "dev@example.com"},
+		Subject:     "errors in app",
+		QuietPeriod: 30 * time.Millisecond,
+		MaxDelay:    time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{
+		Level:    ERROR,
+		Message:  "payment failed",
+		Function: "main.pay",
+		Filename: "/src/main.go",
+		Line:     42,
+		Baggage:  map[string]interface{}{"tenant": "acme", "attempt": 2},
+	})
+	h.Handle(&Record{Level: INFO, Message: "below the threshold"})
+	h.Handle(&Record{Level: CRITICAL, Message: "giving up", Filename: "/src/main.go", Line: 50})
+
+	var mail smtpMail
+	select {
+	case mail = <-mails:
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest not sent")
+	}
+	assert.Equal(t, []string{"PLAIN", "user", "secret"}, mail.auth)
+	assert.False(t, mail.tls)
+	assert.Equal(t, "<app@example.com>", mail.from)
+	assert.Equal(t, []string{"<ops@example.com>", "<dev@example.com>"}, mail.to)
+	assert.Contains(t, mail.data, "Subject: errors in app\r\n")
+	assert.Contains(t, mail.data, "\r\n\r\n2 records logged by "+procName+":\r\n"+
+		"\r\npayment failed\r\n"+
+		"\tcaller: main.pay (/src/main.go:42)\r\n"+
+		"\tattempt: 2\r\n"+
+		"\ttenant: acme\r\n"+
+		"\r\ngiving up\r\n"+
+		"\tcaller: /src/main.go:50\r\n")
+}
+
+func TestSMTPHandlerSendsDigestAfterMaxDelay(t *testing.T) {
+	addr, mails := startSMTPStub(t, nil)
+
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     addr,
+		From:        "app@example.com",
+		To:          []string{"ops@example.com"},
+		QuietPeriod: time.Hour,
+		MaxDelay:    30 * time.Millisecond,
+		MaxRecords:  1,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "first"})
+	h.Handle(&Record{Level: ERROR, Message: "second"})
+
+	select {
+	case mail := <-mails:
+		assert.Nil(t, mail.auth)
+		assert.Contains(t, mail.data, "Subject: "+procName+": 2 records logged\r\n")
+		assert.Contains(t, mail.data, "\r\nfirst\r\n")
+		assert.NotContains(t, mail.data, "second")
+		assert.Contains(t, mail.data, "\r\n1 more records omitted\r\n")
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest not sent")
+	}
+}
+
+func TestSMTPHandlerLoginAuthWithSTARTTLSOnClose(t *testing.T) {
+	serverConfig, clientConfig := newTestTLSConfigs(t)
+	addr, mails := startSMTPStub(t, serverConfig)
+
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     addr,
+		Username:    "user",
+		Password:    "secret",
+		Auth:        SMTPAuthLogin,
+		TLSConfig:   clientConfig,
+		RequireTLS:  true,
+		From:        "app@example.com",
+		To:          []string{"ops@example.com"},
+		QuietPeriod: time.Hour,
+	})
+	require.NoError(t, err)
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: ERROR, Message: "pending on close"})
+	require.NoError(t, h.Close())
+
+	mail := <-mails
+	assert.True(t, mail.tls)
+	assert.Equal(t, []string{"LOGIN", "user", "secret"}, mail.auth)
+	assert.Contains(t, mail.data, "\r\npending on close\r\n")
+
+	h.Handle(&Record{Level: ERROR, Message: "after close"})
+	require.NoError(t, h.Flush())
+	assert.Len(t, mails, 0)
+}
+
+func TestSMTPHandlerRequireTLS(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+
+	addr, mails := startSMTPStub(t, nil)
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     addr,
+		RequireTLS:  true,
+		From:        "app@example.com",
+		To:          []string{"ops@example.com"},
+		QuietPeriod: time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Message: "not sent"})
+	assert.EqualError(t, h.Flush(), "can't send digest of 1 records: server doesn't support STARTTLS")
+	assert.Len(t, errs, 1)
+	assert.Len(t, mails, 0)
+}
+
+func TestSMTPHandlerTimesOutWithStalledServers(t *testing.T) {
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(error) {}
+	defer func() { OnHandlerError = onHandlerError }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		// Connections are accepted but never answered.
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     listener.Addr().String(),
+		From:        "app@example.com",
+		To:          []string{"ops@example.com"},
+		QuietPeriod: time.Hour,
+		Timeout:     50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	h.Handle(&Record{Level: ERROR, Message: "not sent"})
+	err = h.Flush()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "i/o timeout")
+}
+
+func TestSMTPHandlerEncodesSubject(t *testing.T) {
+	addr, mails := startSMTPStub(t, nil)
+	h, err := NewSMTPHandler(SMTPConfig{
+		Address:     addr,
+		From:        "app@example.com",
+		To:          []string{"ops@example.com"},
+		Subject:     "errores en la aplicación",
+		QuietPeriod: time.Hour,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+
+	h.Handle(&Record{Level: ERROR, Message: "error"})
+	require.NoError(t, h.Flush())
+	mail := <-mails
+	assert.Contains(t, mail.data, "Subject: =?utf-8?q?errores_en_la_aplicaci=C3=B3n?=\r\n")
+}
+
+func TestSMTPHandlerRejectsLineBreaksInHeaders(t *testing.T) {
+	for _, cfg := range []SMTPConfig{
+		{From: "app@example.com\r\nBcc: spy@example.com", To: []string{"ops@example.com"}},
+		{From: "app@example.com", To: []string{"ops@example.com\nBcc: spy@example.com"}},
+		{From: "app@example.com", To: []string{"ops@example.com"}, Subject: "errors\r\nBcc: spy@example.com"},
+	} {
+		cfg.Address = "127.0.0.1:25"
+		_, err := NewSMTPHandler(cfg)
+		assert.Error(t, err)
+	}
+}
+
+// startSMTPStub starts an SMTP server accepting any credentials and sending the received
+// mails to the returned channel. It offers STARTTLS if tlsConfig is not nil.
+func startSMTPStub(t *testing.T, tlsConfig *tls.Config) (string, <-chan smtpMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	mails := make(chan smtpMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTPStub(conn, tlsConfig, mails)
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func serveSMTPStub(conn net.Conn, tlsConfig *tls.Config, mails chan<- smtpMail) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var mail smtpMail
+	_ = tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "EHLO", "HELO":
+			if tlsConfig != nil && !mail.tls {
+				_ = tp.PrintfLine("250-stub\r\n250-STARTTLS\r\n250 AUTH PLAIN LOGIN")
+			} else {
+				_ = tp.PrintfLine("250-stub\r\n250 AUTH PLAIN LOGIN")
+			}
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			conn = tls.Server(conn, tlsConfig)
+			tp = textproto.NewConn(conn)
+			mail.tls = true
+		case "AUTH":
+			if strings.ToUpper(fields[1]) == "PLAIN" {
+				decoded, _ := base64.StdEncoding.DecodeString(fields[2])
+				parts := bytes.Split(decoded, []byte{0})
+				mail.auth = []string{"PLAIN", string(parts[1]), string(parts[2])}
+			} else {
+				mail.auth = []string{"LOGIN"}
+				for _, prompt := range []string{"Username:", "Password:"} {
+					_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+					response, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					decoded, _ := base64.StdEncoding.DecodeString(response)
+					mail.auth = append(mail.auth, string(decoded))
+				}
+			}
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			mail.from = strings.TrimPrefix(line[len("MAIL "):], "FROM:")
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, strings.TrimPrefix(line[len("RCPT "):], "TO:"))
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = strings.Replace(string(data), "\n", "\r\n", -1)
+			mails <- mail
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
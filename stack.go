@@ -0,0 +1,174 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// NOSTACK is the stack level that disables stack capturing, it's the default
+// value of DefaultStackLevel.
+const NOSTACK Level = -1
+
+// maxStackDepth is the maximum number of frames captured in a Stack.
+const maxStackDepth = 64
+
+// TrimStackFrames controls whether the leading frames that belong to this package,
+// or to functions marked with Helper, are removed from captured stacks, so they
+// start at the log call site.
+var TrimStackFrames = true
+
+// helpers contains the names of the functions marked with Helper.
+var helpers sync.Map
+
+// Helper marks the calling function as a logging helper, like testing.T.Helper does.
+// Helpers are skipped when reporting the file and line of records, so wrappers
+// around loggers don't need to use SetCallDepth.
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	helpers.Store(frame.Function, struct{}{})
+}
+
+// StackLeveler is implemented by loggers that can capture the stack of their records,
+// like the ones created with NewLogger. It's not part of Logger so existing
+// implementations of Logger don't need to implement it.
+type StackLeveler interface {
+	// SetStackLevel sets the level at or above which records carry the stack
+	// of the log call. Default is logging.DefaultStackLevel.
+	SetStackLevel(Level)
+}
+
+// Frame is a single function call of a Stack.
+type Frame struct {
+	Function string `json:"function"` // Package qualified function name
+	File     string `json:"file"`     // File name (absolute path)
+	Line     int    `json:"line"`     // Line number in file
+}
+
+// Stack is a list of frames, from the innermost call to the outermost one.
+type Stack []Frame
+
+// String returns the stack as an indented block, one function per line
+// followed by its file and line, like the ones printed by the runtime on panics.
+func (s Stack) String() string {
+	var b strings.Builder
+	for i, f := range s {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "\t%s\n\t\t%s:%d", f.Function, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// captureStack returns the current stack skipping the given number of frames,
+// where 0 identifies the caller of captureStack. When TrimStackFrames is set, the
+// stack starts at the same frame as the one returned by caller for the given depth.
+func captureStack(skip, depth int) Stack {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	stack := stackFromPCs(pcs[:n])
+	if TrimStackFrames {
+		stack = trimLoggingFrames(stack, depth)
+	}
+	return stack
+}
+
+// stackFromPCs resolves the given program counters, as returned by runtime.Callers, into a Stack.
+func stackFromPCs(pcs []uintptr) Stack {
+	if len(pcs) == 0 {
+		return nil
+	}
+	stack := make(Stack, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// caller returns the first frame of the stack that doesn't belong to this package,
+// to the runtime or to a helper, skipping the given number of frames first,
+// where 0 identifies the caller of caller. The depth is the number of non wrapper
+// frames to skip, like the ones of wrappers not marked with Helper.
+func caller(skip, depth int) (runtime.Frame, bool) {
+	var pcs [maxStackDepth]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(skip+2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !isWrapperFrame(frame.Function, frame.File) {
+			if depth == 0 {
+				return frame, true
+			}
+			depth--
+		}
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+// trimLoggingFrames removes the leading frames that belong to this package,
+// to the runtime or to helpers, and then the given depth of non wrapper frames.
+func trimLoggingFrames(stack Stack, depth int) Stack {
+	for i, f := range stack {
+		if !isWrapperFrame(f.Function, f.File) {
+			if depth == 0 {
+				return stack[i:]
+			}
+			depth--
+		}
+	}
+	return stack
+}
+
+// isWrapperFrame returns whether the frame belongs to this package, to the runtime
+// or to a function marked with Helper. Frames from test files are not considered
+// part of this package.
+func isWrapperFrame(function, file string) bool {
+	if packageName(function) == packagePath && !strings.HasSuffix(file, "_test.go") {
+		return true
+	}
+	if strings.HasPrefix(function, "runtime.") {
+		return true
+	}
+	_, ok := helpers.Load(function)
+	return ok
+}
+
+// packagePath is the import path of this package.
+var packagePath = packageName(runtime.FuncForPC(reflect.ValueOf(NewLogger).Pointer()).Name())
+
+// shortFilename returns the file name with its parent directory only, like "go-logging/logger.go".
+func shortFilename(file string) string {
+	dir, base := path.Split(file)
+	return path.Join(path.Base(dir), base)
+}
+
+// packageName returns the import path of the package of a qualified function name,
+// like "github.com/cabify/go-logging" for "github.com/cabify/go-logging.(*logger).Info".
+func packageName(function string) string {
+	lastSlash := strings.LastIndex(function, "/")
+	if lastSlash < 0 {
+		lastSlash = 0
+	}
+	if dot := strings.Index(function[lastSlash:], "."); dot >= 0 {
+		return function[:lastSlash+dot]
+	}
+	return function
+}
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackIsCapturedAtStackLevel(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	l.(StackLeveler).SetStackLevel(ERROR)
+
+	l.Warning("no stack")
+	l.Error("stack")
+	l.Criticalf("stack %d", 2)
+
+	require.Len(t, records, 3)
+	assert.Empty(t, records[0].Stack)
+	for _, rec := range records[1:] {
+		require.NotEmpty(t, rec.Stack)
+		assert.Equal(t, "github.com/cabify/go-logging.TestStackIsCapturedAtStackLevel", rec.Stack[0].Function)
+		assert.True(t, strings.HasSuffix(rec.Stack[0].File, "stack_test.go"))
+	}
+}
+
+func TestStackSkipsCallDepthFrames(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	l.SetCallDepth(1)
+	l.(StackLeveler).SetStackLevel(ERROR)
+
+	logThroughWrapper(l, "stack")
+
+	require.Len(t, records, 1)
+	require.NotEmpty(t, records[0].Stack)
+	assert.Equal(t, "github.com/cabify/go-logging.TestStackSkipsCallDepthFrames", records[0].Stack[0].Function)
+	assert.Equal(t, records[0].Line, records[0].Stack[0].Line)
+}
+
+func TestStackLevelIsForwardedByNoDebugLogger(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	NoDebugLogger{Logger: l}.SetStackLevel(ERROR)
+
+	l.Error("stack")
+
+	require.Len(t, records, 1)
+	assert.NotEmpty(t, records[0].Stack)
+}
+
+// logThroughWrapper is a wrapper not marked with Helper, skipped with SetCallDepth.
+func logThroughWrapper(l Logger, message string) {
+	l.Error(message)
+}
+
+func TestStackIsNotCapturedByDefault(t *testing.T) {
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+
+	l.Critical("no stack")
+
+	require.Len(t, records, 1)
+	assert.Empty(t, records[0].Stack)
+}
+
+func TestStackKeepsLoggingFramesWhenNotTrimmed(t *testing.T) {
+	defer func(trim bool) { TrimStackFrames = trim }(TrimStackFrames)
+	TrimStackFrames = false
+
+	var records []*Record
+	l := NewLogger("test")
+	l.SetHandler(handlerFunc(func(rec *Record) { records = append(records, rec) }))
+	l.(StackLeveler).SetStackLevel(ERROR)
+
+	l.Error("stack")
+
+	require.Len(t, records, 1)
+	require.NotEmpty(t, records[0].Stack)
+	assert.Equal(t, packagePath, packageName(records[0].Stack[0].Function))
+}
+
+func TestFormattersRenderStack(t *testing.T) {
+	rec := &Record{
+		Level:   ERROR,
+		Message: "Hello World!",
+		Stack: Stack{
+			{Function: "main.handle", File: "/src/main.go", Line: 42},
+			{Function: "main.main", File: "/src/main.go", Line: 10},
+		},
+	}
+
+	t.Run("default formatter renders an indented block", func(t *testing.T) {
+		lines := strings.Split(DefaultFormatter.Format(rec), "\n")
+		assert.Equal(t, []string{
+			"\tmain.handle",
+			"\t\t/src/main.go:42",
+			"\tmain.main",
+			"\t\t/src/main.go:10",
+		}, lines[1:])
+	})
+
+	t.Run("json formatter renders an array", func(t *testing.T) {
+		var decoded struct {
+			Stack []map[string]interface{} `json:"stack"`
+		}
+		require.NoError(t, json.NewDecoder(bytes.NewBufferString(JSONFormatter{}.Format(rec))).Decode(&decoded))
+		assert.Equal(t, []map[string]interface{}{
+			{"function": "main.handle", "file": "/src/main.go", "line": 42.0},
+			{"function": "main.main", "file": "/src/main.go", "line": 10.0},
+		}, decoded.Stack)
+	})
+}
+
+type handlerFunc func(*Record)
+
+func (f handlerFunc) SetFormatter(Formatter) {}
+func (f handlerFunc) SetLevel(Level)         {}
+func (f handlerFunc) Handle(rec *Record)     { f(rec) }
+func (f handlerFunc) Close() error           { return nil }
@@ -0,0 +1,240 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Presets of WebhookConfig.Template.
+const (
+	// SlackWebhookTemplate is compatible with Slack incoming webhooks and similar chat services.
+	SlackWebhookTemplate = `{"text": {{json .Text}}}`
+	// GenericWebhookTemplate sends the text of the alert, the records as objects
+	// with their fields and baggage, and the number of suppressed records.
+	GenericWebhookTemplate = `{"text": {{json .Text}}, "records": {{json .Records}}, "suppressed": {{.Suppressed}}}`
+)
+
+// Defaults of WebhookConfig.
+const (
+	DefaultWebhookInterval           = time.Minute
+	DefaultWebhookMaxAlertsPerHour   = 20
+	DefaultWebhookMaxRecordsPerAlert = 10
+	DefaultWebhookTimeout            = 10 * time.Second
+)
+
+// WebhookConfig configures a WebhookHandler.
+type WebhookConfig struct {
+	// URL of the webhook.
+	URL string
+	// Template of the JSON body of the requests, executed with a WebhookAlert, with a json
+	// function encoding its argument as JSON. GenericWebhookTemplate by default.
+	Template string
+	// Headers are added to every request.
+	Headers map[string]string
+	// Interval during which records are aggregated in a single alert, DefaultWebhookInterval by default.
+	Interval time.Duration
+	// MaxAlertsPerHour is the maximum number of alerts sent in any hour, records of alerts above
+	// it are suppressed and counted in the next alert. DefaultWebhookMaxAlertsPerHour by default.
+	MaxAlertsPerHour int
+	// MaxRecordsPerAlert is the maximum number of records included in an alert, others are
+	// counted as suppressed. DefaultWebhookMaxRecordsPerAlert by default.
+	MaxRecordsPerAlert int
+	// Client sends the requests, a client with a DefaultWebhookTimeout timeout by default.
+	Client *http.Client
+}
+
+// WebhookAlert is the data of the template of the requests of a WebhookHandler.
+type WebhookAlert struct {
+	// Text has a line for each formatted record, followed by the number of suppressed records if any.
+	Text string
+	// Records of the alert, with their fields and baggage.
+	Records []map[string]interface{}
+	// Suppressed is the number of records not included in this alert, or suppressed since the previous one.
+	Suppressed int
+}
+
+// WebhookHandler sends alerts with the logging output to a webhook, like a chat channel.
+// Only CRITICAL records are sent by default. Records are aggregated in a single alert per
+// interval, and a maximum number of alerts per hour is enforced. Errors sending alerts are
+// reported with OnHandlerError.
+type WebhookHandler struct {
+	*BaseHandler
+	cfg      WebhookConfig
+	template *template.Template
+	now      func() time.Time
+
+	m          sync.Mutex
+	pending    []*Record
+	timer      *time.Timer
+	sent       []time.Time
+	suppressed int
+	closed     bool
+}
+
+// NewWebhookHandler returns a WebhookHandler sending alerts to the configured URL.
+func NewWebhookHandler(cfg WebhookConfig) (*WebhookHandler, error) {
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	if cfg.Template == "" {
+		cfg.Template = GenericWebhookTemplate
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultWebhookInterval
+	}
+	if cfg.MaxAlertsPerHour <= 0 {
+		cfg.MaxAlertsPerHour = DefaultWebhookMaxAlertsPerHour
+	}
+	if cfg.MaxRecordsPerAlert <= 0 {
+		cfg.MaxRecordsPerAlert = DefaultWebhookMaxRecordsPerAlert
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	tmpl, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+
+	h := &WebhookHandler{
+		BaseHandler: NewBaseHandler(),
+		cfg:         cfg,
+		template:    tmpl,
+		now:         time.Now,
+	}
+	h.SetLevel(CRITICAL)
+	// Records released by request buffers below the level are not sent.
+	h.FilterReleased = true
+	return h, nil
+}
+
+func (h *WebhookHandler) Handle(rec *Record) {
+	if !h.Filter(rec) {
+		return
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.closed {
+		return
+	}
+	h.pending = append(h.pending, rec)
+	if h.timer == nil {
+		h.timer = time.AfterFunc(h.cfg.Interval, h.alert)
+	}
+}
+
+// Flush sends the pending records without waiting for the end of the interval.
+func (h *WebhookHandler) Flush() error {
+	h.alert()
+	return nil
+}
+
+// Close sends the pending records, and reports with OnHandlerError the number of records
+// suppressed since the last alert, since no other alert will count them.
+func (h *WebhookHandler) Close() error {
+	h.m.Lock()
+	h.closed = true
+	h.m.Unlock()
+	h.alert()
+
+	h.m.Lock()
+	suppressed := h.suppressed
+	h.suppressed = 0
+	h.m.Unlock()
+	if suppressed > 0 {
+		OnHandlerError(fmt.Errorf("%d records suppressed by the webhook alert budget were not sent", suppressed))
+	}
+	return nil
+}
+
+// alert sends the pending records in an alert, or suppresses them if the hourly budget is spent.
+func (h *WebhookHandler) alert() {
+	h.m.Lock()
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	records := h.pending
+	h.pending = nil
+	if len(records) == 0 {
+		h.m.Unlock()
+		return
+	}
+
+	now := h.now()
+	for len(h.sent) > 0 && now.Sub(h.sent[0]) >= time.Hour {
+		h.sent = h.sent[1:]
+	}
+	if len(h.sent) >= h.cfg.MaxAlertsPerHour {
+		h.suppressed += len(records)
+		h.m.Unlock()
+		return
+	}
+	h.sent = append(h.sent, now)
+
+	suppressed := h.suppressed
+	h.suppressed = 0
+	if len(records) > h.cfg.MaxRecordsPerAlert {
+		suppressed += len(records) - h.cfg.MaxRecordsPerAlert
+		records = records[:h.cfg.MaxRecordsPerAlert]
+	}
+	h.m.Unlock()
+
+	if err := h.send(records, suppressed); err != nil {
+		OnHandlerError(fmt.Errorf("can't send webhook alert with %d records: %v", len(records), err))
+	}
+}
+
+func (h *WebhookHandler) send(records []*Record, suppressed int) error {
+	alert := WebhookAlert{Suppressed: suppressed}
+	lines := make([]string, 0, len(records)+1)
+	for _, rec := range records {
+		lines = append(lines, strings.TrimSuffix(h.Formatter.Format(rec), "\n"))
+		alert.Records = append(alert.Records, recordFields(rec))
+	}
+	if suppressed > 0 {
+		lines = append(lines, fmt.Sprintf("%d more suppressed", suppressed))
+	}
+	alert.Text = strings.Join(lines, "\n")
+
+	body := &bytes.Buffer{}
+	if err := h.template.Execute(body, alert); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.cfg.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range h.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
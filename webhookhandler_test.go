@@ -0,0 +1,141 @@
+package log
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandlerSlackPresetAggregatesInterval(t *testing.T) {
+	bodies := serveWebhook(t)
+
+	h, err := NewWebhookHandler(WebhookConfig{
+		URL:      bodies.url,
+		Template: SlackWebhookTemplate,
+		Interval: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: CRITICAL, Message: "database is down"})
+	h.Handle(&Record{Level: ERROR, Message: "below the threshold"})
+	h.Handle(&Record{Level: CRITICAL, Message: "queue is \"full\"\n"})
+
+	select {
+	case body := <-bodies.ch:
+		assert.JSONEq(t, `{"text": "database is down\nqueue is \"full\""}`, body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert not sent")
+	}
+	assert.Len(t, bodies.ch, 0)
+}
+
+func TestWebhookHandlerGenericPreset(t *testing.T) {
+	bodies := serveWebhook(t)
+
+	h, err := NewWebhookHandler(WebhookConfig{URL: bodies.url, Interval: time.Hour, MaxRecordsPerAlert: 2})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+
+	h.Handle(&Record{Level: CRITICAL, Message: "first", LoggerName: "payments", Baggage: map[string]interface{}{"tenant": "acme"}})
+	h.Handle(&Record{Level: CRITICAL, Message: "second"})
+	h.Handle(&Record{Level: CRITICAL, Message: "third"})
+	require.NoError(t, h.Flush())
+
+	var alert struct {
+		Text       string                   `json:"text"`
+		Records    []map[string]interface{} `json:"records"`
+		Suppressed int                      `json:"suppressed"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(<-bodies.ch), &alert))
+	assert.Equal(t, "first\nsecond\n1 more suppressed", alert.Text)
+	assert.Equal(t, 1, alert.Suppressed)
+	require.Len(t, alert.Records, 2)
+	assert.Equal(t, "payments", alert.Records[0]["logger"])
+	assert.Equal(t, "acme", alert.Records[0]["tenant"])
+	assert.Equal(t, "CRITICAL", alert.Records[1]["level"])
+}
+
+func TestWebhookHandlerHourlyBudget(t *testing.T) {
+	bodies := serveWebhook(t)
+
+	h, err := NewWebhookHandler(WebhookConfig{
+		URL:              bodies.url,
+		Template:         SlackWebhookTemplate,
+		Interval:         time.Hour,
+		MaxAlertsPerHour: 1,
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.SetFormatter(messageFormatter{})
+	now := testRecordTime
+	h.now = func() time.Time { return now }
+
+	h.Handle(&Record{Level: CRITICAL, Message: "sent"})
+	require.NoError(t, h.Flush())
+	assert.JSONEq(t, `{"text": "sent"}`, <-bodies.ch)
+
+	now = now.Add(59 * time.Minute)
+	h.Handle(&Record{Level: CRITICAL, Message: "suppressed"})
+	h.Handle(&Record{Level: CRITICAL, Message: "suppressed too"})
+	require.NoError(t, h.Flush())
+	assert.Len(t, bodies.ch, 0)
+
+	now = now.Add(time.Minute)
+	h.Handle(&Record{Level: CRITICAL, Message: "sent again"})
+	require.NoError(t, h.Flush())
+	assert.JSONEq(t, `{"text": "sent again\n2 more suppressed"}`, <-bodies.ch)
+}
+
+func TestWebhookHandlerReportsSuppressedRecordsOnClose(t *testing.T) {
+	var errs []error
+	onHandlerError := OnHandlerError
+	OnHandlerError = func(err error) { errs = append(errs, err) }
+	defer func() { OnHandlerError = onHandlerError }()
+	bodies := serveWebhook(t)
+
+	h, err := NewWebhookHandler(WebhookConfig{URL: bodies.url, Interval: time.Hour, MaxAlertsPerHour: 1})
+	require.NoError(t, err)
+	h.Handle(&Record{Level: CRITICAL, Message: "sent"})
+	require.NoError(t, h.Flush())
+	<-bodies.ch
+
+	h.Handle(&Record{Level: CRITICAL, Message: "suppressed"})
+	require.NoError(t, h.Flush())
+	h.Handle(&Record{Level: CRITICAL, Message: "suppressed on close"})
+	require.NoError(t, h.Close())
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "2 records suppressed")
+	assert.Len(t, bodies.ch, 0)
+}
+
+func TestWebhookHandlerInvalidTemplate(t *testing.T) {
+	_, err := NewWebhookHandler(WebhookConfig{URL: "http://localhost", Template: "{{.Text"})
+	assert.Error(t, err)
+}
+
+type webhookBodies struct {
+	url string
+	ch  chan string
+}
+
+func serveWebhook(t *testing.T) webhookBodies {
+	bodies := webhookBodies{ch: make(chan string, 10)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies.ch <- string(body)
+	}))
+	t.Cleanup(server.Close)
+	bodies.url = server.URL
+	return bodies
+}
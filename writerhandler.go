@@ -34,6 +34,20 @@ func (b *WriterHandler) Handle(rec *Record) {
 	b.m.Unlock()
 }
 
+// Flush flushes the writer if it has a Flush() error or Sync() error method, implementing Flusher.
+func (b *WriterHandler) Flush() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	switch w := b.w.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	default:
+		return nil
+	}
+}
+
 func (b *WriterHandler) Close() error {
 	if c, ok := b.w.(io.Closer); ok {
 		return c.Close()